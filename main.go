@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
 
 	"github.com/treaster/incant/processor"
 )
@@ -11,60 +15,72 @@ func main() {
 	var configPath string
 	flag.StringVar(&configPath, "config", "", "YAML file defining static site params")
 
-	flag.Parse()
+	var env string
+	flag.StringVar(&env, "env", os.Getenv("INCANT_ENV"), "Environment name, e.g. production. Applies config.<env>.* and site content overlays")
 
-	templateMgrFactories := map[string]func(string) processor.TemplateMgr{
-		"go/template": processor.GoTemplateMgr,
-		"jet":         processor.JetTemplateMgr,
-	}
+	var drafts bool
+	flag.BoolVar(&drafts, "drafts", false, "Include items marked as drafts")
 
-	proc, hasErrors := processor.Load(os.ReadFile, configPath, templateMgrFactories)
-	if hasErrors {
-		processor.Printfln("ERROR loading config")
-		os.Exit(1)
-	}
+	var output string
+	flag.StringVar(&output, "output", "", "Output directory, or archive file ending in .zip or .tar.gz. Overrides OutputRoot")
 
-	hasError := proc.LoadTemplates()
-	if hasError {
-		processor.Printfln("ERROR loading template files")
-		os.Exit(1)
-	}
+	var future bool
+	flag.BoolVar(&future, "future", false, "Include items with a publish date in the future")
 
-	siteContent, hasErrors := proc.LoadSiteContent()
-	if hasErrors {
-		processor.Printfln("ERROR loading site content")
-		os.Exit(1)
+	// The first argument may name a command. The default command builds the
+	// site.
+	command := "build"
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command = args[0]
+		args = args[1:]
 	}
-	if siteContent == nil {
-		processor.Printfln("ERROR site content is nil.")
+	if command != "build" && command != "lint" {
+		processor.Printfln("ERROR unrecognized command %q. Expected build or lint.", command)
 		os.Exit(1)
 	}
 
-	allMappings, hasErrors := proc.LoadMappings()
-	if hasErrors {
-		processor.Printfln("ERROR loading mapping files")
-		os.Exit(1)
-	}
-	if len(allMappings) == 0 {
-		processor.Printfln("No mapping files found. Aborting.")
-		os.Exit(1)
+	flag.CommandLine.Parse(args)
+
+	overrideConfig := func(config *processor.Config) {
+		config.Drafts = config.Drafts || drafts
+		config.Future = config.Future || future
 	}
 
-	hasErrors = proc.ClearExistingOutput()
-	if hasErrors {
-		processor.Printfln("ERROR clearing existing output")
-		os.Exit(1)
+	// Site files are read, and output written, relative to the directory of
+	// the config file. The --output flag is relative to the working directory.
+	siteDir := filepath.Dir(configPath)
+	configName := ""
+	if configPath != "" {
+		configName = filepath.Base(configPath)
+	}
+	newSink := func(outputRoot string) (processor.OutputSink, error) {
+		if output != "" {
+			return processor.NewOutputSink(output), nil
+		}
+		return processor.NewOutputSink(filepath.Join(siteDir, outputRoot)), nil
 	}
 
-	hasErrors = proc.ProcessContent(allMappings, siteContent)
-	if hasErrors {
-		processor.Printfln("ERROR processing mapping + site content")
-		os.Exit(1)
+	opts := processor.BuildOptions{
+		SiteFS:         os.DirFS(siteDir),
+		ConfigPath:     configName,
+		Env:            env,
+		LookupEnv:      os.LookupEnv,
+		OverrideConfig: overrideConfig,
+		NewSink:        newSink,
+		ExecDir:        siteDir,
 	}
 
-	hasErrors = proc.CopyStatic()
-	if hasErrors {
-		processor.Printfln("ERROR copying static files")
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	run := processor.Build
+	if command == "lint" {
+		run = processor.Lint
+	}
+	_, err := run(ctx, opts)
+	if err != nil {
+		processor.Printfln("ERROR %s", err.Error())
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,308 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"time"
+)
+
+// Phase names one step of a build.
+type Phase string
+
+const (
+	PhaseLoadConfig     Phase = "load-config"
+	PhaseLoadContent    Phase = "load-content"
+	PhaseLoadMappings   Phase = "load-mappings"
+	PhaseLoadTemplates  Phase = "load-templates"
+	PhaseLint           Phase = "lint"
+	PhaseClearOutput    Phase = "clear-output"
+	PhaseProcessContent Phase = "process-content"
+	PhaseCopyStatic     Phase = "copy-static"
+	PhaseCloseOutput    Phase = "close-output"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic is an error or warning reported while building a site.
+type Diagnostic struct {
+	Phase    Phase
+	Severity Severity
+	Message  string
+}
+
+// diagnostics collects the Diagnostics of a build, as well as printing them.
+type diagnostics struct {
+	phase Phase
+	list  []Diagnostic
+}
+
+func (d *diagnostics) errorfln(format string, args ...any) bool {
+	d.list = append(d.list, Diagnostic{d.phase, SeverityError, fmt.Sprintf(format, args...)})
+	return Errorfln(format, args...)
+}
+
+func (d *diagnostics) warnfln(format string, args ...any) {
+	d.list = append(d.list, Diagnostic{d.phase, SeverityWarning, fmt.Sprintf(format, args...)})
+	Printfln(format, args...)
+}
+
+// addErrors records errors which have already been printed.
+func (d *diagnostics) addErrors(errs []error) bool {
+	for _, err := range errs {
+		d.list = append(d.list, Diagnostic{d.phase, SeverityError, err.Error()})
+	}
+	return len(errs) > 0
+}
+
+// BuildOptions configure Build, Lint and Load. Only SiteFS and ConfigPath are
+// required.
+type BuildOptions struct {
+	// SiteFS holds the site. ConfigPath is relative to it, and every other
+	// site path is relative to the directory of ConfigPath.
+	SiteFS     fs.FS
+	ConfigPath string
+	// Env selects environment overlays, e.g. "production".
+	Env string
+	// LookupEnv reads INCANT_<FIELD> config overrides, e.g. os.LookupEnv. If
+	// nil, the environment is not consulted.
+	LookupEnv func(string) (string, bool)
+	// OverrideConfig is applied last to the loaded config.
+	OverrideConfig func(*Config)
+
+	// TemplateMgrFactories defaults to DefaultTemplateMgrFactories().
+	TemplateMgrFactories map[string]func(TemplateMgrOptions) TemplateMgr
+	// Funcs are added to the standard template functions.
+	Funcs map[string]any
+	// Decoders defaults to DefaultDecoders().
+	Decoders map[string]Decoder
+	// Types are registered with RegisterType, keyed by name.
+	Types map[string]any
+	// Themes holds themes by name, such as an embed.FS bundled with a Go
+	// module. Config Themes which aren't found here are directories.
+	Themes map[string]fs.FS
+	// ExecDir is the directory on disk holding the config file, which is
+	// where the commands of exec: content references run. Without it, they
+	// can't be enabled.
+	ExecDir string
+
+	// NewSink creates the output for the configured OutputRoot. If nil, the
+	// output is kept in memory and returned in BuildResult.Files.
+	NewSink func(outputRoot string) (OutputSink, error)
+
+	Hooks BuildHooks
+}
+
+// BuildHooks let embedding programs observe and extend a build. Any hook may
+// be nil. A hook returning an error stops the build.
+type BuildHooks struct {
+	BeforePhase func(ctx context.Context, phase Phase) error
+	AfterPhase  func(ctx context.Context, phase Phase, duration time.Duration) error
+	// OnOutput is called for each output file, before it is written.
+	OnOutput func(relPath string, contents []byte) error
+}
+
+type PhaseDuration struct {
+	Phase    Phase
+	Duration time.Duration
+}
+
+type BuildResult struct {
+	// Outputs lists the output files written, in the order they were written.
+	Outputs []string
+	// Files holds the output when BuildOptions.NewSink is nil.
+	Files       map[string][]byte
+	Durations   []PhaseDuration
+	Diagnostics []Diagnostic
+}
+
+// ErrBuildFailed is returned by Build and Lint when a phase reports errors.
+// The errors themselves are in BuildResult.Diagnostics.
+var ErrBuildFailed = errors.New("build failed")
+
+// DefaultTemplateMgrFactories returns every built-in template engine, keyed by
+// TemplatesType.
+func DefaultTemplateMgrFactories() map[string]func(TemplateMgrOptions) TemplateMgr {
+	return map[string]func(TemplateMgrOptions) TemplateMgr{
+		"go/template":      GoTemplateMgr,
+		"go/html-template": GoHtmlTemplateMgr,
+		"jet":              JetTemplateMgr,
+	}
+}
+
+// Build builds a site, running every phase in order. It stops at the first
+// phase which reports errors, or when ctx is cancelled. The result is
+// returned even when the build fails.
+func Build(ctx context.Context, opts BuildOptions) (*BuildResult, error) {
+	return runBuild(ctx, opts, false)
+}
+
+// Lint loads a site and lints its templates, without writing any output.
+func Lint(ctx context.Context, opts BuildOptions) (*BuildResult, error) {
+	return runBuild(ctx, opts, true)
+}
+
+// outputRecorder wraps an OutputSink to report each output file.
+type outputRecorder struct {
+	OutputSink
+	onWrite func(relPath string, contents []byte) error
+	result  *BuildResult
+}
+
+func (r *outputRecorder) WriteFile(relPath string, contents []byte) error {
+	if r.onWrite != nil {
+		err := r.onWrite(relPath, contents)
+		if err != nil {
+			return err
+		}
+	}
+	err := r.OutputSink.WriteFile(relPath, contents)
+	if err != nil {
+		return err
+	}
+	r.result.Outputs = append(r.result.Outputs, relPath)
+	return nil
+}
+
+func runBuild(ctx context.Context, opts BuildOptions, lint bool) (*BuildResult, error) {
+	result := &BuildResult{}
+	diags := &diagnostics{}
+	var memorySink *MemorySink
+	defer func() {
+		result.Diagnostics = diags.list
+		if memorySink != nil {
+			result.Files = memorySink.Files
+		}
+	}()
+
+	// runPhase runs one phase with its hooks. fn reports whether the phase
+	// had errors.
+	runPhase := func(phase Phase, fn func() bool) error {
+		err := ctx.Err()
+		if err != nil {
+			return err
+		}
+		diags.phase = phase
+		if opts.Hooks.BeforePhase != nil {
+			err := opts.Hooks.BeforePhase(ctx, phase)
+			if err != nil {
+				return fmt.Errorf("before %s: %w", phase, err)
+			}
+		}
+
+		start := time.Now()
+		hasError := fn()
+		duration := time.Since(start)
+		result.Durations = append(result.Durations, PhaseDuration{phase, duration})
+
+		// A cancelled phase stops early and reports an error, so cancellation
+		// is checked first.
+		err = ctx.Err()
+		if err != nil {
+			return err
+		}
+		if hasError {
+			return fmt.Errorf("%w in phase %s", ErrBuildFailed, phase)
+		}
+		if opts.Hooks.AfterPhase != nil {
+			err := opts.Hooks.AfterPhase(ctx, phase, duration)
+			if err != nil {
+				return fmt.Errorf("after %s: %w", phase, err)
+			}
+		}
+		return nil
+	}
+
+	newSink := opts.NewSink
+	if newSink == nil {
+		newSink = func(string) (OutputSink, error) {
+			memorySink = NewMemorySink()
+			return memorySink, nil
+		}
+	}
+	opts.NewSink = func(outputRoot string) (OutputSink, error) {
+		sink, err := newSink(outputRoot)
+		if err != nil {
+			return nil, err
+		}
+		return &outputRecorder{sink, opts.Hooks.OnOutput, result}, nil
+	}
+
+	var p *processor
+	err := runPhase(PhaseLoadConfig, func() bool {
+		var hasError bool
+		p, hasError = load(ctx, diags, opts)
+		return hasError
+	})
+	if err != nil {
+		return result, err
+	}
+
+	var siteContent any
+	err = runPhase(PhaseLoadContent, func() bool {
+		var hasError bool
+		siteContent, hasError = p.LoadSiteContent()
+		return hasError
+	})
+	if err != nil {
+		return result, err
+	}
+
+	var allMappings []MappingForTemplate
+	err = runPhase(PhaseLoadMappings, func() bool {
+		var hasError bool
+		allMappings, hasError = p.LoadMappings()
+		if !hasError && len(allMappings) == 0 {
+			hasError = diags.errorfln("no mapping files named %q found", p.config.MappingFile)
+		}
+		return hasError
+	})
+	if err != nil {
+		return result, err
+	}
+
+	// Templates are loaded after mappings, which can choose the engine each
+	// template is parsed with.
+	err = runPhase(PhaseLoadTemplates, p.LoadTemplates)
+	if err != nil {
+		return result, err
+	}
+
+	if lint {
+		err = runPhase(PhaseLint, func() bool {
+			return p.Lint(allMappings, siteContent)
+		})
+		return result, err
+	}
+
+	err = runPhase(PhaseClearOutput, p.ClearExistingOutput)
+	if err != nil {
+		return result, err
+	}
+	result.Outputs = nil
+
+	err = runPhase(PhaseProcessContent, func() bool {
+		return p.ProcessContent(allMappings, siteContent)
+	})
+	if err != nil {
+		return result, err
+	}
+
+	err = runPhase(PhaseCopyStatic, p.CopyStatic)
+	if err != nil {
+		return result, err
+	}
+
+	err = runPhase(PhaseCloseOutput, p.CloseOutput)
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
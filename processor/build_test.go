@@ -0,0 +1,204 @@
+package processor_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/treaster/incant/processor"
+
+	"github.com/stretchr/testify/require"
+)
+
+func buildTestSite(templates map[string]string) map[string]string {
+	files := map[string]string{
+		"site/config.yaml": `
+ContentRoot: content
+SiteContentFile: site.yaml
+MappingFile: mapping.yaml
+TemplatesRoot: templates
+TemplatesType: go/template
+StaticRoot: static
+OutputRoot: output
+`,
+		"site/content/site.yaml": `
+pages:
+  - name: a
+  - name: b
+`,
+		"site/content/mapping.yaml": `
+- PerMatchOutput: jq:.name + ".html"
+  Template: page.html
+  Selector: jq:.pages[]
+`,
+		"site/static/site.css": `body {}`,
+	}
+	for name, contents := range templates {
+		files["site/templates/"+name] = contents
+	}
+	return files
+}
+
+func TestBuild(t *testing.T) {
+	siteFS := mapFS(buildTestSite(map[string]string{
+		"page.html": `{{.name}} is {{Size .name}}`,
+	}))
+
+	var events []string
+	var outputs []string
+	result, err := processor.Build(context.Background(), processor.BuildOptions{
+		SiteFS:     siteFS,
+		ConfigPath: "site/config.yaml",
+		Funcs: map[string]any{
+			"Size": func(s string) int { return len(s) },
+		},
+		Hooks: processor.BuildHooks{
+			BeforePhase: func(ctx context.Context, phase processor.Phase) error {
+				events = append(events, "before "+string(phase))
+				return nil
+			},
+			AfterPhase: func(ctx context.Context, phase processor.Phase, duration time.Duration) error {
+				events = append(events, "after "+string(phase))
+				return nil
+			},
+			OnOutput: func(relPath string, contents []byte) error {
+				outputs = append(outputs, relPath)
+				return nil
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"a.html", "b.html", "static/site.css"}, result.Outputs)
+	require.Equal(t, result.Outputs, outputs)
+	require.Equal(t, map[string][]byte{
+		"a.html":          []byte("a is 1"),
+		"b.html":          []byte("b is 1"),
+		"static/site.css": []byte("body {}"),
+	}, result.Files)
+	require.Empty(t, result.Diagnostics)
+
+	phases := []processor.Phase{
+		processor.PhaseLoadConfig,
+		processor.PhaseLoadContent,
+		processor.PhaseLoadMappings,
+		processor.PhaseLoadTemplates,
+		processor.PhaseClearOutput,
+		processor.PhaseProcessContent,
+		processor.PhaseCopyStatic,
+		processor.PhaseCloseOutput,
+	}
+	var expectedEvents []string
+	for i, phase := range phases {
+		expectedEvents = append(expectedEvents, "before "+string(phase), "after "+string(phase))
+		require.Equal(t, phase, result.Durations[i].Phase)
+	}
+	require.Equal(t, expectedEvents, events)
+	require.Len(t, result.Durations, len(phases))
+}
+
+func TestBuildDiagnostics(t *testing.T) {
+	siteFS := mapFS(buildTestSite(map[string]string{
+		"page.html":   `{{.name}}`,
+		"unused.html": `{{.missing}}`,
+	}))
+
+	result, err := processor.Lint(context.Background(), processor.BuildOptions{
+		SiteFS:     siteFS,
+		ConfigPath: "site/config.yaml",
+	})
+	require.NoError(t, err)
+	require.Equal(t, []processor.Diagnostic{
+		{processor.PhaseLint, processor.SeverityWarning, `warning: template "unused.html" is not used by any mapping`},
+	}, result.Diagnostics)
+	require.Empty(t, result.Outputs)
+
+	siteFS = mapFS(buildTestSite(map[string]string{
+		"page.html": `{{template "missing.html"}}`,
+	}))
+	result, err = processor.Build(context.Background(), processor.BuildOptions{
+		SiteFS:     siteFS,
+		ConfigPath: "site/config.yaml",
+	})
+	require.ErrorIs(t, err, processor.ErrBuildFailed)
+	require.EqualError(t, err, "build failed in phase process-content")
+	require.Len(t, result.Diagnostics, 2)
+	require.Equal(t, processor.PhaseProcessContent, result.Diagnostics[0].Phase)
+	require.Equal(t, processor.SeverityError, result.Diagnostics[0].Severity)
+	require.Contains(t, result.Diagnostics[0].Message, `template "missing.html" not defined`)
+}
+
+func TestBuildBadFuncs(t *testing.T) {
+	for name, fn := range map[string]any{"Nil": nil, "Number": 3} {
+		result, err := processor.Build(context.Background(), processor.BuildOptions{
+			SiteFS:     mapFS(buildTestSite(map[string]string{"page.html": `{{.name}}`})),
+			ConfigPath: "site/config.yaml",
+			Funcs:      map[string]any{name: fn},
+		})
+		require.ErrorIs(t, err, processor.ErrBuildFailed, name)
+		require.Equal(t, processor.PhaseLoadConfig, result.Diagnostics[0].Phase, name)
+		require.Contains(t, result.Diagnostics[0].Message, "custom template function "+`"`+name+`"`, name)
+		require.Contains(t, result.Diagnostics[0].Message, "not a function", name)
+	}
+}
+
+func TestBuildPathsOutsideSite(t *testing.T) {
+	for field, replacement := range map[string]string{
+		"ContentRoot: content": "ContentRoot: ../shared",
+		"StaticRoot: static":   "StaticRoot: /srv/static",
+	} {
+		files := buildTestSite(map[string]string{"page.html": `{{.name}}`})
+		files["site/config.yaml"] = strings.Replace(files["site/config.yaml"], field, replacement, 1)
+		result, err := processor.Build(context.Background(), processor.BuildOptions{
+			SiteFS:     mapFS(files),
+			ConfigPath: "site/config.yaml",
+		})
+		require.ErrorIs(t, err, processor.ErrBuildFailed, field)
+		require.Equal(t, processor.PhaseLoadConfig, result.Diagnostics[0].Phase, field)
+		require.Contains(t, result.Diagnostics[0].Message, "must be a relative path within the directory of the config file", field)
+	}
+}
+
+func TestBuildCancelled(t *testing.T) {
+	siteFS := mapFS(buildTestSite(map[string]string{
+		"page.html": `{{.name}}`,
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var written []string
+	result, err := processor.Build(ctx, processor.BuildOptions{
+		SiteFS:     siteFS,
+		ConfigPath: "site/config.yaml",
+		Hooks: processor.BuildHooks{
+			// Cancel part way through writing the output.
+			OnOutput: func(relPath string, contents []byte) error {
+				written = append(written, relPath)
+				cancel()
+				return nil
+			},
+		},
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, []string{"a.html"}, written)
+	require.Equal(t, []string{"a.html"}, result.Outputs)
+	require.Equal(t, processor.PhaseProcessContent, result.Durations[len(result.Durations)-1].Phase)
+
+	result, err = processor.Build(context.Background(), processor.BuildOptions{
+		SiteFS:     siteFS,
+		ConfigPath: "site/config.yaml",
+		Hooks: processor.BuildHooks{
+			BeforePhase: func(ctx context.Context, phase processor.Phase) error {
+				if phase == processor.PhaseCopyStatic {
+					return errors.New("no static files today")
+				}
+				return nil
+			},
+		},
+	})
+	require.EqualError(t, err, "before copy-static: no static files today")
+	require.Equal(t, []string{"a.html", "b.html"}, result.Outputs)
+}
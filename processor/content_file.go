@@ -2,13 +2,14 @@ package processor
 
 import (
 	"fmt"
+	"path/filepath"
 	"reflect"
 	"strings"
 
 	"github.com/treaster/gotl"
 )
 
-type context struct {
+type evalContext struct {
 	loader FileLoader
 
 	inProgress *gotl.Set[string]
@@ -17,14 +18,14 @@ type context struct {
 	errors     []error
 }
 
-func (ctx *context) addError(s string, args ...any) {
+func (ctx *evalContext) addError(s string, args ...any) {
 	errorStr := fmt.Sprintf(s, args...)
 	stackStr := fmt.Sprintf("stack: [%s]", strings.Join(ctx.stack, " -> "))
 	ctx.errors = append(ctx.errors, fmt.Errorf("%s (%s)", errorStr, stackStr))
 }
 
 func EvalContentFile(loader FileLoader, filePath string) (any, []error) {
-	ctx := context{
+	ctx := evalContext{
 		loader,
 		gotl.NewSet[string](),
 		map[string]any{},
@@ -44,7 +45,7 @@ func EvalContentFile(loader FileLoader, filePath string) (any, []error) {
 	return result, ctx.errors
 }
 
-func evalOneFile(ctx *context, contentPath string, allowAsString bool) any {
+func evalOneFile(ctx *evalContext, contentPath string, allowAsString bool) any {
 	if ctx.inProgress.Has(contentPath) {
 		ctx.addError("circular reference with %q", contentPath)
 		return nil
@@ -82,7 +83,7 @@ func evalOneFile(ctx *context, contentPath string, allowAsString bool) any {
 	}
 }
 
-func evalValue(ctx *context, stackKey string, contentValue reflect.Value) any {
+func evalValue(ctx *evalContext, stackKey string, contentValue reflect.Value) any {
 	ctx.stack = append(ctx.stack, stackKey)
 	defer func() {
 		ctx.stack = ctx.stack[:len(ctx.stack)-1]
@@ -101,7 +102,10 @@ func evalValue(ctx *context, stackKey string, contentValue reflect.Value) any {
 			}
 			subMap[iter.Key().String()] = newValue
 		}
-		return subMap
+		if _, isSQLite := subMap[sqliteKey]; isSQLite {
+			return evalSQLite(ctx, subMap)
+		}
+		return applyDirectives(ctx, subMap)
 	case reflect.Slice:
 		fallthrough
 	case reflect.Array:
@@ -122,6 +126,15 @@ func evalValue(ctx *context, stackKey string, contentValue reflect.Value) any {
 		case strings.HasPrefix(s, "file:"):
 			filePath := SafeCutPrefix(s, "file:")
 			return evalOneFile(ctx, filePath, true)
+		case strings.HasPrefix(s, "glob:"):
+			pattern := SafeCutPrefix(s, "glob:")
+			return evalGlob(ctx, pattern)
+		case strings.HasPrefix(s, "dir:"):
+			dirPath := SafeCutPrefix(s, "dir:")
+			return evalDir(ctx, dirPath)
+		case strings.HasPrefix(s, "exec:"):
+			command := SafeCutPrefix(s, "exec:")
+			return evalExec(ctx, command)
 		default:
 			return s
 		}
@@ -129,3 +142,42 @@ func evalValue(ctx *context, stackKey string, contentValue reflect.Value) any {
 		return contentValue.Interface()
 	}
 }
+
+// evalGlob evaluates every file matching pattern, returning them as a list in
+// sorted path order.
+func evalGlob(ctx *evalContext, pattern string) any {
+	matches, err := ctx.loader.Glob(pattern)
+	if err != nil {
+		ctx.addError("error in glob pattern %q: %s", pattern, err.Error())
+		return nil
+	}
+
+	results := make([]any, 0, len(matches))
+	for _, match := range matches {
+		results = append(results, evalOneFile(ctx, match, true))
+	}
+	return results
+}
+
+// evalDir evaluates every content file beneath dirPath, returning them as a
+// map keyed by the file's path relative to dirPath. Files in formats the
+// loader doesn't understand are skipped.
+func evalDir(ctx *evalContext, dirPath string) any {
+	prefix := filepath.Clean(dirPath) + "/"
+
+	files, err := ctx.loader.FindFilesUnder(dirPath)
+	if err != nil {
+		ctx.addError("error listing directory %q: %s", dirPath, err.Error())
+		return nil
+	}
+
+	results := map[string]any{}
+	for _, file := range files {
+		if !ctx.loader.SupportsFormat(file) {
+			continue
+		}
+		relPath := strings.TrimPrefix(file, prefix)
+		results[relPath] = evalOneFile(ctx, file, false)
+	}
+	return results
+}
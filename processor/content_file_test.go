@@ -2,25 +2,28 @@ package processor_test
 
 import (
 	"errors"
-	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/treaster/incant/processor"
 
 	"github.com/stretchr/testify/require"
 )
 
-func makeFileLoader(data map[string]string) processor.FileLoader {
-	return processor.MakeFileLoader(
-		func(filename string) ([]byte, error) {
-			s, hasFile := data[filename]
-			if !hasFile {
-				return nil, fmt.Errorf("no file named %q", filename)
-			}
+func mapFS(data map[string]string) fstest.MapFS {
+	fsys := fstest.MapFS{}
+	for name, contents := range data {
+		fsys[name] = &fstest.MapFile{Data: []byte(contents)}
+	}
+	return fsys
+}
 
-			return []byte(s), nil
-		},
-	)
+func makeFileLoader(data map[string]string) processor.FileLoader {
+	return processor.MakeFileLoader(mapFS(data), ".", processor.DefaultDecoders())
 }
 
 func TestEvalContentFile(t *testing.T) {
@@ -150,3 +153,203 @@ func TestEvalContentFile(t *testing.T) {
 			}
 	*/
 }
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	for name, contents := range files {
+		fullPath := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(fullPath), 0755))
+		require.NoError(t, os.WriteFile(fullPath, []byte(contents), 0644))
+	}
+}
+
+func TestEvalContentFileGlob(t *testing.T) {
+	siteRoot := t.TempDir()
+	writeFiles(t, siteRoot, map[string]string{
+		"content/site.yaml": `
+            recipes: "glob:recipes/*.yaml"
+            byPath: "dir:recipes"
+            `,
+		"content/recipes/b.yaml":       `name: b`,
+		"content/recipes/a.yaml":       `name: a`,
+		"content/recipes/notes.txt":    `not content`,
+		"content/recipes/sub/c.yaml":   `name: c`,
+		"content/recipes/sub/.d.yaml":  `name: d`,
+		"content/elsewhere/e.yaml":     `name: e`,
+		"content/recipes/sub/ref.yaml": `other: "file:elsewhere/e.yaml"`,
+	})
+
+	loader := processor.MakeFileLoader(os.DirFS(siteRoot), "content", processor.DefaultDecoders())
+	actual, errs := processor.EvalContentFile(loader, "site.yaml")
+	require.Equal(t, 0, len(errs))
+
+	expected := map[string]any{
+		"recipes": []any{
+			map[string]any{"name": "a"},
+			map[string]any{"name": "b"},
+		},
+		"byPath": map[string]any{
+			"a.yaml":       map[string]any{"name": "a"},
+			"b.yaml":       map[string]any{"name": "b"},
+			"sub/c.yaml":   map[string]any{"name": "c"},
+			"sub/ref.yaml": map[string]any{"other": map[string]any{"name": "e"}},
+		},
+	}
+	require.Equal(t, expected, actual)
+
+	// Circular references through a glob are still detected.
+	writeFiles(t, siteRoot, map[string]string{
+		"content/loop/a.yaml": `all: "glob:loop/*.yaml"`,
+	})
+	_, errs = processor.EvalContentFile(loader, "loop/a.yaml")
+	require.Equal(t, 1, len(errs))
+	require.Contains(t, errs[0].Error(), `circular reference with "loop/a.yaml"`)
+}
+
+func TestEvalContentFileFormats(t *testing.T) {
+	siteRoot := t.TempDir()
+	writeFiles(t, siteRoot, map[string]string{
+		"content/site.yml": `
+            plain: "file:plain.json"
+            prices: "file:prices.csv"
+            inferred: "file:prices.csv?infer=true"
+            semicolons: "file:semicolons.csv?delimiter=;&header=false"
+            tabs: "file:tabs.tsv"
+            exported: "file:exported.csv"
+            questions: "file:what?.json"
+            versioned: "file:faq?v=2.csv"
+            `,
+		"content/plain.json":     `{"name": "cake"}`,
+		"content/prices.csv":     "item,price,vegan,added\ncake,3.5,false,2024-01-02\n\"pie, apple\",4,true,\n",
+		"content/semicolons.csv": "a;1\nb;2\n",
+		// TSV fields aren't quoted, so quotes are kept.
+		"content/tabs.tsv":    "item\tprice\r\n\"Eat\" she said\t3.5\r\n",
+		"content/ragged.tsv":  "item\tprice\ncake\n",
+		"content/what?.json":  `{"name": "pie"}`,
+		"content/faq?v=2.csv": "item\ncake\n",
+		// Spreadsheet exports often start with a byte order mark.
+		"content/exported.csv": "\xef\xbb\xbfitem,price\ncake,3.5\n",
+	})
+
+	loader := processor.MakeFileLoader(os.DirFS(siteRoot), "content", processor.DefaultDecoders())
+	actual, errs := processor.EvalContentFile(loader, "site.yml")
+	require.Equal(t, 0, len(errs))
+
+	expected := map[string]any{
+		"plain": map[string]any{"name": "cake"},
+		"prices": []any{
+			map[string]any{"item": "cake", "price": "3.5", "vegan": "false", "added": "2024-01-02"},
+			map[string]any{"item": "pie, apple", "price": "4", "vegan": "true", "added": ""},
+		},
+		"inferred": []any{
+			map[string]any{"item": "cake", "price": 3.5, "vegan": false, "added": time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+			map[string]any{"item": "pie, apple", "price": 4, "vegan": true, "added": ""},
+		},
+		"semicolons": []any{
+			[]any{"a", "1"},
+			[]any{"b", "2"},
+		},
+		"tabs": []any{
+			map[string]any{"item": `"Eat" she said`, "price": "3.5"},
+		},
+		"exported": []any{
+			map[string]any{"item": "cake", "price": "3.5"},
+		},
+		"questions": map[string]any{"name": "pie"},
+		"versioned": []any{
+			map[string]any{"item": "cake"},
+		},
+	}
+	require.Equal(t, expected, actual)
+
+	var rows []map[string]string
+	require.NoError(t, loader.LoadFile("tabs.tsv", &rows))
+	require.Equal(t, []map[string]string{{"item": `"Eat" she said`, "price": "3.5"}}, rows)
+
+	require.Error(t, loader.LoadFile("prices.csv?colour=red", &rows))
+	require.EqualError(t, loader.LoadFile("ragged.tsv", &rows), "line 2 has 1 fields, expected 2")
+}
+
+func TestCustomDecoder(t *testing.T) {
+	decoders := processor.DefaultDecoders()
+	decoders[".properties"] = processor.UnmarshalDecoder(func(data []byte, output any) error {
+		values := map[string]any{}
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			key, value, _ := strings.Cut(line, "=")
+			values[key] = value
+		}
+		*(output.(*any)) = values
+		return nil
+	})
+
+	files := map[string]string{
+		"site.yaml":         `settings: "file:app.properties"`,
+		"app.properties":    "name=incant\ncolor=blue",
+		"data.xml":          `<x/>`,
+		"with-options.yaml": `x: "file:app.properties?a=b"`,
+	}
+	loader := processor.MakeFileLoader(mapFS(files), ".", decoders)
+
+	actual, errs := processor.EvalContentFile(loader, "site.yaml")
+	require.Equal(t, 0, len(errs))
+	require.Equal(t, map[string]any{
+		"settings": map[string]any{"name": "incant", "color": "blue"},
+	}, actual)
+
+	var output any
+	err := loader.LoadFile("data.xml", &output)
+	require.EqualError(t, err, `unsupported extension ".xml" on file path "data.xml"; supported extensions are .csv, .hjson, .json, .json5, .properties, .toml, .tsv, .yaml, .yml`)
+
+	_, errs = processor.EvalContentFile(loader, "with-options.yaml")
+	require.Equal(t, 1, len(errs))
+	require.Contains(t, errs[0].Error(), `this format takes no options, got "a=b"`)
+}
+
+func TestEvalContentFileExtends(t *testing.T) {
+	input := map[string]string{
+		"base.yaml": `
+            servings: 2
+            tags: [dinner]
+            steps: [boil]
+            nutrition:
+                calories: 400
+                allergens: [gluten]
+            `,
+		"item.yaml": `
+            $extends: "file:base.yaml"
+            $merge:
+                tags: append
+                nutrition.allergens: append
+            title: Spaghetti
+            servings: 4
+            tags: [pasta]
+            steps: [boil, drain]
+            nutrition:
+                allergens: [egg]
+            `,
+	}
+
+	expected := map[string]any{
+		"title":    "Spaghetti",
+		"servings": 4,
+		"tags":     []any{"dinner", "pasta"},
+		"steps":    []any{"boil", "drain"},
+		"nutrition": map[string]any{
+			"calories":  400,
+			"allergens": []any{"gluten", "egg"},
+		},
+	}
+
+	actual, errs := processor.EvalContentFile(makeFileLoader(input), "item.yaml")
+	require.Equal(t, 0, len(errs))
+	require.Equal(t, expected, actual)
+
+	// $merge without $extends is an error.
+	input = map[string]string{
+		"item.yaml": `
+            $merge: append
+            title: Spaghetti
+            `,
+	}
+	_, errs = processor.EvalContentFile(makeFileLoader(input), "item.yaml")
+	require.Equal(t, 1, len(errs))
+}
@@ -0,0 +1,218 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// ExecRunner runs the commands of exec: content references, such as
+// "exec:scripts/authors.sh?format=json".
+type ExecRunner struct {
+	// Dir is the directory on disk that commands run in. Commands containing
+	// a "/" are relative to it; others are found on the PATH.
+	Dir string
+	// Allow lists the commands which may be run, as path.Match patterns,
+	// e.g. "scripts/*.sh" or "git". Only the program is matched; its
+	// arguments aren't restricted, so allowing a program like sh or git lets
+	// content run anything that program can.
+	Allow []string
+	// CacheDir optionally keeps the output of programs in Dir on disk between
+	// builds, keyed by the program's contents and its arguments. Anything
+	// else the program reads doesn't invalidate it. Programs on the PATH, like
+	// git, are only cached for the current build, since their output depends
+	// on more than their arguments.
+	CacheDir string
+
+	// ctx stops commands which are still running when the build is
+	// cancelled.
+	ctx context.Context
+	// cache holds the output of each command run, by input hash.
+	cache map[string][]byte
+}
+
+func NewExecRunner(ctx context.Context, dir string, allow []string, cacheDir string) *ExecRunner {
+	return &ExecRunner{dir, allow, cacheDir, ctx, map[string][]byte{}}
+}
+
+// Run runs a command line, split on spaces into the program and its
+// arguments, and returns its stdout. Output is cached by a hash of the
+// command line and, for programs in Dir, the contents of the program. Only the
+// output of programs in Dir is cached in CacheDir.
+func (r *ExecRunner) Run(commandLine string) ([]byte, error) {
+	args := strings.Fields(commandLine)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+	program := args[0]
+	if strings.Contains(program, "/") {
+		program = path.Clean(filepath.ToSlash(program))
+	}
+	if !r.isAllowed(program) {
+		return nil, fmt.Errorf("command %q is not allowed by ExecAllow", program)
+	}
+
+	var programPath string
+	hash := sha256.New()
+	isInDir := strings.Contains(program, "/")
+	if isInDir {
+		// The program is run from Dir, so its path must be absolute.
+		var err error
+		programPath, err = filepath.Abs(filepath.Join(r.Dir, filepath.FromSlash(program)))
+		if err != nil {
+			return nil, err
+		}
+		contents, err := os.ReadFile(programPath)
+		if err != nil {
+			return nil, err
+		}
+		hash.Write(contents)
+	} else {
+		var err error
+		programPath, err = exec.LookPath(program)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, arg := range args {
+		fmt.Fprintf(hash, "\x00%s", arg)
+	}
+	key := hex.EncodeToString(hash.Sum(nil))
+
+	output, isCached := r.cache[key]
+	if isCached {
+		return output, nil
+	}
+	cachePath := ""
+	if r.CacheDir != "" && isInDir {
+		cachePath = filepath.Join(r.CacheDir, key)
+		output, err := os.ReadFile(cachePath)
+		if err == nil {
+			r.cache[key] = output
+			return output, nil
+		}
+	}
+
+	cmd := exec.CommandContext(r.ctx, programPath, args[1:]...)
+	cmd.Dir = r.Dir
+	// Processes started by the command may hold its output open after it is
+	// killed, so don't wait on them for long.
+	cmd.WaitDelay = time.Second
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if r.ctx.Err() != nil {
+		return nil, r.ctx.Err()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", err.Error(), strings.TrimSpace(stderr.String()))
+	}
+
+	r.cache[key] = output
+	if cachePath != "" {
+		err := os.MkdirAll(r.CacheDir, 0755)
+		if err == nil {
+			err = os.WriteFile(cachePath, output, 0644)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error caching output: %s", err.Error())
+		}
+	}
+	return output, nil
+}
+
+func (r *ExecRunner) isAllowed(program string) bool {
+	for _, pattern := range r.Allow {
+		isMatch, _ := path.Match(pattern, program)
+		if isMatch {
+			return true
+		}
+	}
+	return false
+}
+
+// execFormat returns the extension of the format that a command's output is
+// decoded with, and the remaining decoder options. A "format" option names it,
+// e.g. "format=json". Otherwise it is taken from the program name, as in
+// authors.json.sh.
+func execFormat(commandLine string, options string) (string, string, error) {
+	var remaining []string
+	format := ""
+	if options != "" {
+		for _, option := range strings.Split(options, "&") {
+			key, value, _ := strings.Cut(option, "=")
+			if key == "format" {
+				format = "." + strings.TrimPrefix(value, ".")
+				continue
+			}
+			remaining = append(remaining, option)
+		}
+	}
+
+	if format == "" {
+		fields := strings.Fields(commandLine)
+		if len(fields) > 0 {
+			noExt, _ := TrimExt(path.Base(fields[0]))
+			format = path.Ext(noExt)
+		}
+	}
+	if format == "" {
+		return "", "", fmt.Errorf("no output format; add one with ?format=, e.g. ?format=json")
+	}
+	return format, strings.Join(remaining, "&"), nil
+}
+
+// evalExec runs the command of an exec: reference, and evaluates its decoded
+// output like the contents of a file.
+func evalExec(ctx *evalContext, command string) any {
+	key := "exec:" + command
+	if ctx.inProgress.Has(key) {
+		ctx.addError("circular reference with %q", key)
+		return nil
+	}
+	value, isProcessed := ctx.allResults[key]
+	if isProcessed {
+		return value
+	}
+
+	if ctx.loader.exec == nil {
+		ctx.addError("unable to run %q: exec: references are disabled, since ExecAllow is empty", command)
+		return nil
+	}
+
+	commandLine, options, _ := strings.Cut(command, "?")
+	format, options, err := execFormat(commandLine, options)
+	if err != nil {
+		ctx.addError("unable to run %q: %s", command, err.Error())
+		return nil
+	}
+
+	output, err := ctx.loader.exec.Run(commandLine)
+	if err != nil {
+		ctx.addError("error running %q: %s", command, err.Error())
+		return nil
+	}
+
+	var decoded any
+	err = ctx.loader.Decode(output, format, &decoded, options)
+	if err != nil {
+		ctx.addError("unable to decode output of %q: %s", command, err.Error())
+		return nil
+	}
+
+	ctx.inProgress.Add(key)
+	value = evalValue(ctx, key, reflect.ValueOf(decoded))
+	ctx.inProgress.Remove(key)
+
+	ctx.allResults[key] = value
+	return value
+}
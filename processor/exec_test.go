@@ -0,0 +1,103 @@
+package processor_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/treaster/incant/processor"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvalContentExec(t *testing.T) {
+	siteRoot := t.TempDir()
+	writeFiles(t, siteRoot, map[string]string{
+		"content/site.yaml": `
+authors: "exec:scripts/authors.json.sh"
+again: "exec:scripts/authors.json.sh"
+tags: "exec:scripts/echo.sh a b?format=yaml"
+`,
+		// Counts its runs in runs.txt, to check caching.
+		"scripts/authors.json.sh": "#!/bin/sh\necho run >> runs.txt\necho '[{\"name\": \"ann\", \"bio\": \"file:bio.yaml\"}]'\n",
+		"scripts/echo.sh":         "#!/bin/sh\necho \"[$1, $2]\"\n",
+		"scripts/self.yaml.sh":    "#!/bin/sh\necho 'self: \"exec:scripts/self.yaml.sh\"'\n",
+		"scripts/fail.yaml.sh":    "#!/bin/sh\necho oops >&2\nexit 3\n",
+		"content/bio.yaml":        `likes: cake`,
+		"content/self.yaml":       `x: "exec:scripts/self.yaml.sh"`,
+		"content/fail.yaml":       `x: "exec:scripts/fail.yaml.sh"`,
+		"content/blocked.yaml":    `x: "exec:rm -rf /tmp/nothing?format=json"`,
+		"content/noformat.yaml":   `x: "exec:scripts/echo.sh"`,
+		// Commands on the PATH only share output within a build.
+		"content/path.yaml":     "a: \"exec:count.yaml.sh\"\nb: \"exec:count.yaml.sh\"",
+		"scripts/count.yaml.sh": "#!/bin/sh\necho run >> path-runs.txt\nwc -l < path-runs.txt\n",
+		"content/slow.yaml":     `x: "exec:scripts/slow.yaml.sh"`,
+		"scripts/slow.yaml.sh":  "#!/bin/sh\nsleep 10\n",
+	})
+	for _, script := range []string{"authors.json.sh", "echo.sh", "self.yaml.sh", "fail.yaml.sh", "count.yaml.sh", "slow.yaml.sh"} {
+		require.NoError(t, os.Chmod(filepath.Join(siteRoot, "scripts", script), 0755))
+	}
+	// count.yaml.sh is also run as a command on the PATH.
+	t.Setenv("PATH", filepath.Join(siteRoot, "scripts")+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	allow := []string{"scripts/*.sh", "count.yaml.sh"}
+	cacheDir := filepath.Join(siteRoot, ".cache")
+	newLoader := func() processor.FileLoader {
+		return processor.MakeFileLoader(os.DirFS(siteRoot), "content", processor.DefaultDecoders()).
+			WithExec(processor.NewExecRunner(context.Background(), siteRoot, allow, cacheDir))
+	}
+
+	authors := []any{map[string]any{"name": "ann", "bio": map[string]any{"likes": "cake"}}}
+	expected := map[string]any{
+		"authors": authors,
+		"again":   authors,
+		"tags":    []any{"a", "b"},
+	}
+	actual, errs := processor.EvalContentFile(newLoader(), "site.yaml")
+	require.Equal(t, 0, len(errs))
+	require.Equal(t, expected, actual)
+
+	// The output is cached on disk, so a new build doesn't run the script.
+	actual, errs = processor.EvalContentFile(newLoader(), "site.yaml")
+	require.Equal(t, 0, len(errs))
+	require.Equal(t, expected, actual)
+	runs, err := os.ReadFile(filepath.Join(siteRoot, "runs.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "run\n", string(runs))
+
+	for _, expectedRuns := range []int{1, 2} {
+		actual, errs := processor.EvalContentFile(newLoader(), "path.yaml")
+		require.Equal(t, 0, len(errs))
+		require.Equal(t, map[string]any{"a": expectedRuns, "b": expectedRuns}, actual)
+	}
+
+	for file, expectedError := range map[string]string{
+		"self.yaml":     `circular reference with "exec:scripts/self.yaml.sh"`,
+		"fail.yaml":     `error running "scripts/fail.yaml.sh": exit status 3: oops`,
+		"blocked.yaml":  `command "rm" is not allowed by ExecAllow`,
+		"noformat.yaml": `no output format`,
+	} {
+		_, errs := processor.EvalContentFile(newLoader(), file)
+		require.Equal(t, 1, len(errs), file)
+		require.Contains(t, errs[0].Error(), expectedError, file)
+	}
+
+	// Commands are stopped when the build is cancelled.
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	started := time.Now()
+	loader := processor.MakeFileLoader(os.DirFS(siteRoot), "content", processor.DefaultDecoders()).
+		WithExec(processor.NewExecRunner(ctx, siteRoot, allow, ""))
+	_, errs = processor.EvalContentFile(loader, "slow.yaml")
+	require.Equal(t, 1, len(errs))
+	require.Contains(t, errs[0].Error(), `error running "scripts/slow.yaml.sh": context canceled`)
+	require.Less(t, time.Since(started), 5*time.Second)
+
+	// Without a runner, exec: references are disabled.
+	loader = processor.MakeFileLoader(os.DirFS(siteRoot), "content", processor.DefaultDecoders())
+	_, errs = processor.EvalContentFile(loader, "self.yaml")
+	require.Equal(t, 1, len(errs))
+	require.Contains(t, errs[0].Error(), "exec: references are disabled")
+}
@@ -0,0 +1,256 @@
+package processor
+
+import (
+	"fmt"
+	"html"
+	"path"
+	"strings"
+)
+
+// Language configures one language of a multilingual site. The site is built
+// once per language.
+type Language struct {
+	// Code is the language code, e.g. "en" or "pt-BR", used for hreflang.
+	Code string `yaml:"Code"`
+
+	// ContentRoot optionally names a directory, relative to the config file,
+	// which is layered above the site's ContentRoot for this language. Its
+	// files replace the site's files of the same name, so the site content
+	// file, mapping files, and files reached by file:, glob: and dir: can all
+	// be translated. Files it doesn't have come from the site's ContentRoot.
+	ContentRoot string `yaml:"ContentRoot"`
+
+	// SiteContentFile optionally names a content file, relative to the
+	// language's content root, which is deep-merged on top of the site content
+	// for this language. Only the translated parts of the content need to be
+	// in it.
+	SiteContentFile string `yaml:"SiteContentFile"`
+
+	// OutputPrefix is prepended to every output path of this language, e.g.
+	// "fr/". It may be empty for one language.
+	OutputPrefix string `yaml:"OutputPrefix"`
+
+	// TranslationsFile optionally names a content file, relative to the
+	// language's content root, mapping translation keys to strings for the T function.
+	TranslationsFile string `yaml:"TranslationsFile"`
+}
+
+// Translation is one version of a page, as listed by the Translations
+// template function.
+type Translation struct {
+	Lang string
+	URL  string
+}
+
+// pluralCategories are the CLDR plural categories. A translation whose value
+// is a map with these keys selects a plural form by count.
+var pluralCategories = map[string]bool{
+	"zero":  true,
+	"one":   true,
+	"two":   true,
+	"few":   true,
+	"many":  true,
+	"other": true,
+}
+
+// PluralCategory returns the CLDR plural category of the integer n in the
+// given language. Only the rules for common languages are included; any other
+// language uses the English rule.
+func PluralCategory(lang string, n int) string {
+	base, _, _ := strings.Cut(strings.ToLower(lang), "-")
+	if n < 0 {
+		n = -n
+	}
+	mod10 := n % 10
+	mod100 := n % 100
+
+	switch base {
+	case "ja", "zh", "ko", "th", "vi", "id", "ms", "tr":
+		return "other"
+	case "fr", "pt":
+		if n == 0 || n == 1 {
+			return "one"
+		}
+		return "other"
+	case "ru", "uk", "be", "sr", "hr", "bs":
+		switch {
+		case mod10 == 1 && mod100 != 11:
+			return "one"
+		case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+			return "few"
+		default:
+			return "many"
+		}
+	case "pl":
+		switch {
+		case n == 1:
+			return "one"
+		case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+			return "few"
+		default:
+			return "many"
+		}
+	case "cs", "sk":
+		switch {
+		case n == 1:
+			return "one"
+		case n >= 2 && n <= 4:
+			return "few"
+		default:
+			return "other"
+		}
+	case "ar":
+		switch {
+		case n == 0:
+			return "zero"
+		case n == 1:
+			return "one"
+		case n == 2:
+			return "two"
+		case mod100 >= 3 && mod100 <= 10:
+			return "few"
+		case mod100 >= 11:
+			return "many"
+		default:
+			return "other"
+		}
+	default:
+		if n == 1 {
+			return "one"
+		}
+		return "other"
+	}
+}
+
+// translator holds the translations of every language, and tracks which
+// language and output path are being built, for the i18n template functions.
+type translator struct {
+	languages    []Language
+	translations map[string]map[string]any
+
+	current  Language
+	pagePath string
+}
+
+func newTranslator(languages []Language) *translator {
+	return &translator{
+		languages,
+		map[string]map[string]any{},
+		Language{},
+		"",
+	}
+}
+
+func (tr *translator) funcs() map[string]any {
+	return map[string]any{
+		"T":             tr.T,
+		"i18n":          tr.T,
+		"Lang":          func() string { return tr.current.Code },
+		"Translations":  tr.Translations,
+		"HreflangLinks": tr.HreflangLinks,
+	}
+}
+
+// T looks up key in the translations of the current language, falling back to
+// the first language, and then to the key itself. Nested maps are reached
+// with dotted keys. If the translation is a map of plural forms, the first
+// argument is the count that selects one. The translation is then used as a
+// fmt format string for the arguments.
+func (tr *translator) T(key string, args ...any) (string, error) {
+	value, hasValue := tr.lookup(tr.current.Code, key)
+	if !hasValue && len(tr.languages) > 0 {
+		value, hasValue = tr.lookup(tr.languages[0].Code, key)
+	}
+	if !hasValue {
+		return key, nil
+	}
+
+	if forms, isMap := value.(map[string]any); isMap {
+		if len(args) == 0 {
+			return "", fmt.Errorf("translation %q has plural forms, but no count was given", key)
+		}
+		count, err := toFloat(args[0])
+		if err != nil {
+			return "", fmt.Errorf("translation %q: %s", key, err.Error())
+		}
+		form, hasForm := forms[PluralCategory(tr.current.Code, int(count))]
+		if !hasForm {
+			form = forms["other"]
+		}
+		value = form
+	}
+
+	format, isString := value.(string)
+	if !isString {
+		return "", fmt.Errorf("translation %q is a %T, not a string", key, value)
+	}
+	if len(args) == 0 {
+		return format, nil
+	}
+	return fmt.Sprintf(format, args...), nil
+}
+
+func (tr *translator) lookup(lang string, key string) (any, bool) {
+	var current any = tr.translations[lang]
+	for _, segment := range strings.Split(key, ".") {
+		currentMap, isMap := current.(map[string]any)
+		if !isMap || isPluralForms(currentMap) {
+			return nil, false
+		}
+		next, hasNext := currentMap[segment]
+		if !hasNext {
+			return nil, false
+		}
+		current = next
+	}
+	if currentMap, isMap := current.(map[string]any); isMap && !isPluralForms(currentMap) {
+		return nil, false
+	}
+	return current, true
+}
+
+func isPluralForms(m map[string]any) bool {
+	if _, hasOther := m["other"]; !hasOther {
+		return false
+	}
+	for key := range m {
+		if !pluralCategories[key] {
+			return false
+		}
+	}
+	return true
+}
+
+// PrefixURLPath adds a language's OutputPrefix to an absolute URL path.
+// Relative paths and full URLs are returned unchanged.
+func PrefixURLPath(prefix string, urlPath string) string {
+	if prefix == "" || !strings.HasPrefix(urlPath, "/") {
+		return urlPath
+	}
+	prefixed := "/" + path.Join(prefix, urlPath)
+	if strings.HasSuffix(urlPath, "/") && !strings.HasSuffix(prefixed, "/") {
+		prefixed += "/"
+	}
+	return prefixed
+}
+
+// Translations lists the page being built in every language, including the
+// current one.
+func (tr *translator) Translations() []Translation {
+	translations := make([]Translation, 0, len(tr.languages))
+	for _, language := range tr.languages {
+		url := PrefixURLPath(language.OutputPrefix, "/"+tr.pagePath)
+		translations = append(translations, Translation{language.Code, url})
+	}
+	return translations
+}
+
+// HreflangLinks returns a <link rel="alternate"> element for every
+// translation of the page being built, for the document head.
+func (tr *translator) HreflangLinks() HTML {
+	var b strings.Builder
+	for _, translation := range tr.Translations() {
+		fmt.Fprintf(&b, `<link rel="alternate" hreflang="%s" href="%s">`+"\n", html.EscapeString(translation.Lang), html.EscapeString(translation.URL))
+	}
+	return HTML(b.String())
+}
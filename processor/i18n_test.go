@@ -0,0 +1,150 @@
+package processor_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/treaster/incant/processor"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPluralCategory(t *testing.T) {
+	for _, tc := range []struct {
+		lang     string
+		n        int
+		expected string
+	}{
+		{"en", 1, "one"},
+		{"en", 0, "other"},
+		{"fr", 0, "one"},
+		{"fr", 2, "other"},
+		{"ru", 21, "one"},
+		{"ru", 22, "few"},
+		{"ru", 12, "many"},
+		{"pl", 25, "many"},
+		{"ja", 1, "other"},
+		{"pt-BR", 1, "one"},
+	} {
+		require.Equal(t, tc.expected, processor.PluralCategory(tc.lang, tc.n), "%s %d", tc.lang, tc.n)
+	}
+}
+
+func TestMultilingualSite(t *testing.T) {
+	siteRoot := t.TempDir()
+	writeFiles(t, siteRoot, map[string]string{
+		"config.yaml": `
+ContentRoot: content
+SiteContentFile: site.yaml
+MappingFile: mapping.yaml
+TemplatesRoot: templates
+TemplatesType: go/template
+StaticRoot: static
+OutputRoot: output
+Languages:
+  - Code: en
+    TranslationsFile: i18n/en.yaml
+  - Code: fr
+    OutputPrefix: fr
+    SiteContentFile: site.fr.yaml
+    TranslationsFile: i18n/fr.yaml
+`,
+		"content/site.yaml": `
+recipes:
+  - slug: cake
+    title: Cake
+    servings: 1
+`,
+		"content/site.fr.yaml": `
+recipes:
+  - slug: cake
+    title: Gâteau
+    servings: 1
+`,
+		"content/i18n/en.yaml": `
+home: Home
+servings:
+  one: "%d serving"
+  other: "%d servings"
+`,
+		"content/i18n/fr.yaml": `
+servings:
+  one: "%d portion"
+  other: "%d portions"
+`,
+		"content/mapping.yaml": `
+- PerMatchOutput: jq:"recipes/" + .slug + ".html"
+  Template: recipe.html
+  Selector: jq:.recipes[]
+`,
+		"templates/recipe.html": `{{HreflangLinks}}{{Lang}}: {{.title}}, {{T "servings" .servings}}, {{T "home"}}, {{T "missing"}}`,
+	})
+
+	buildSite(t, siteRoot, nil)
+
+	hreflang := `<link rel="alternate" hreflang="en" href="/recipes/cake.html">` + "\n" +
+		`<link rel="alternate" hreflang="fr" href="/fr/recipes/cake.html">` + "\n"
+	for outputPath, expected := range map[string]string{
+		"recipes/cake.html":    hreflang + "en: Cake, 1 serving, Home, missing",
+		"fr/recipes/cake.html": hreflang + "fr: Gâteau, 1 portion, Home, missing",
+	} {
+		output, err := os.ReadFile(filepath.Join(siteRoot, "output", outputPath))
+		require.NoError(t, err)
+		require.Equal(t, expected, string(output))
+	}
+}
+
+func TestLanguageContentRoot(t *testing.T) {
+	siteRoot := t.TempDir()
+	writeFiles(t, siteRoot, map[string]string{
+		"config.yaml": `
+ContentRoot: content
+SiteContentFile: site.yaml
+MappingFile: mapping.yaml
+TemplatesRoot: templates
+TemplatesType: go/template
+StaticRoot: static
+OutputRoot: output
+Languages:
+  - Code: en
+  - Code: de
+    OutputPrefix: de
+    ContentRoot: content.de
+    SiteContentFile: site.extra.yaml
+`,
+		"content/site.yaml":         `{title: Recipes, recipes: "glob:recipes/*.yaml"}`,
+		"content/recipes/cake.yaml": `{slug: cake, title: Cake}`,
+		"content/recipes/pie.yaml":  `{slug: pie, title: Pie}`,
+		"content/mapping.yaml": `
+- PerMatchOutput: jq:"recipes/" + .slug + ".html"
+  Template: recipe.html
+  Selector: jq:.recipes[]
+`,
+		// Only the cake page and the mapping are translated. The site content
+		// file is the site's, so its glob: finds the translated page.
+		"content.de/recipes/cake.yaml": `{slug: cake, title: Kuchen}`,
+		"content.de/site.extra.yaml":   `{title: Rezepte}`,
+		"content.de/mapping.yaml": `
+- PerMatchOutput: jq:"rezepte/" + .slug + ".html"
+  Template: recipe.html
+  Selector: jq:.recipes[]
+`,
+		"templates/recipe.html": `{{Lang}}: {{.title}}`,
+	})
+
+	buildSite(t, siteRoot, nil)
+
+	for outputPath, expected := range map[string]string{
+		"recipes/cake.html":    "en: Cake",
+		"recipes/pie.html":     "en: Pie",
+		"de/rezepte/cake.html": "de: Kuchen",
+		"de/rezepte/pie.html":  "de: Pie",
+	} {
+		output, err := os.ReadFile(filepath.Join(siteRoot, "output", outputPath))
+		require.NoError(t, err)
+		require.Equal(t, expected, string(output))
+	}
+	_, err := os.Stat(filepath.Join(siteRoot, "output", "de", "recipes"))
+	require.True(t, os.IsNotExist(err))
+}
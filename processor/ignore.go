@@ -0,0 +1,198 @@
+package processor
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// IgnoreFile lists patterns of files to ignore, one per line, in the directory
+// containing it and beneath. It follows the rules of .gitignore files.
+const IgnoreFile = ".incantignore"
+
+// ignoreRule is one compiled ignore pattern, which applies to paths beneath
+// base.
+type ignoreRule struct {
+	base    string
+	pattern *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// IgnoreMatcher decides which files are ignored, using gitignore semantics:
+// the last matching pattern wins, a leading "!" re-includes what an earlier
+// pattern ignored, a trailing "/" matches only directories, and a pattern with
+// no other "/" matches at any depth.
+type IgnoreMatcher struct {
+	rules []ignoreRule
+}
+
+// NewIgnoreMatcher compiles patterns which apply to the whole root.
+func NewIgnoreMatcher(patterns []string) (*IgnoreMatcher, error) {
+	m := &IgnoreMatcher{}
+	for _, pattern := range patterns {
+		err := m.add(".", pattern)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// AddFile adds the patterns of an IgnoreFile in directory base. Blank lines
+// and lines starting with "#" are skipped.
+func (m *IgnoreMatcher) AddFile(base string, contents []byte) error {
+	for i, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimRight(line, " \r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		err := m.add(base, line)
+		if err != nil {
+			return fmt.Errorf("line %d: %s", i+1, err.Error())
+		}
+	}
+	return nil
+}
+
+func (m *IgnoreMatcher) add(base string, pattern string) error {
+	rule := ignoreRule{base: path.Clean(base)}
+	if strings.HasPrefix(pattern, "!") {
+		rule.negate = true
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if pattern == "" {
+		return fmt.Errorf("empty ignore pattern")
+	}
+
+	// Patterns without a slash match a name at any depth. Any other pattern
+	// is anchored to base.
+	if strings.HasPrefix(pattern, "/") {
+		pattern = pattern[1:]
+	} else if !strings.Contains(pattern, "/") {
+		pattern = "**/" + pattern
+	}
+
+	re, err := regexp.Compile("^" + globToRegexp(pattern) + "$")
+	if err != nil {
+		return fmt.Errorf("bad ignore pattern %q: %s", pattern, err.Error())
+	}
+	rule.pattern = re
+	m.rules = append(m.rules, rule)
+	return nil
+}
+
+// globToRegexp translates a gitignore glob into a regular expression. "*"
+// and "?" never match "/", while "**" matches any number of directories.
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// Match reports whether relPath, relative to the root, is ignored.
+func (m *IgnoreMatcher) Match(relPath string, isDir bool) bool {
+	relPath = path.Clean(relPath)
+	isIgnored := false
+	for _, rule := range m.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		rulePath := relPath
+		if rule.base != "." {
+			var isBeneath bool
+			rulePath, isBeneath = strings.CutPrefix(relPath, rule.base+"/")
+			if !isBeneath {
+				continue
+			}
+		}
+		if rule.pattern.MatchString(rulePath) {
+			isIgnored = !rule.negate
+		}
+	}
+	return isIgnored
+}
+
+// walkFiles calls fn with the path of every file beneath fileRoot which isn't
+// ignored, skipping ignored directories entirely. IgnoreFiles found along the
+// way add to ignore, and the walk stops at the first malformed one.
+func walkFiles(fsys fs.FS, fileRoot string, ignore *IgnoreMatcher, fn func(filePath string)) error {
+	if ignore == nil {
+		ignore = &IgnoreMatcher{}
+	}
+	// Rules added by IgnoreFiles must not leak into the caller's matcher.
+	ignore = &IgnoreMatcher{append([]ignoreRule(nil), ignore.rules...)}
+
+	return fs.WalkDir(fsys, fileRoot, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			fmt.Println(err.Error())
+			return nil
+		}
+
+		relPath := filePath
+		if fileRoot != "." {
+			relPath = strings.TrimPrefix(strings.TrimPrefix(filePath, fileRoot), "/")
+		}
+		if relPath != "" && relPath != "." && ignore.Match(relPath, d.IsDir()) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			contents, err := fs.ReadFile(fsys, path.Join(filePath, IgnoreFile))
+			if err == nil {
+				dirPath := relPath
+				if dirPath == "" {
+					dirPath = "."
+				}
+				err = ignore.AddFile(dirPath, contents)
+				if err != nil {
+					return fmt.Errorf("error in %s: %s", path.Join(filePath, IgnoreFile), err.Error())
+				}
+			}
+			return nil
+		}
+
+		fn(filePath)
+		return nil
+	})
+}
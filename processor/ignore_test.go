@@ -0,0 +1,105 @@
+package processor_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/treaster/incant/processor"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIgnoreMatcher(t *testing.T) {
+	m, err := processor.NewIgnoreMatcher([]string{
+		"*.swp",
+		"node_modules/",
+		"/README*",
+		"drafts/**/*.yaml",
+		"*.log",
+		"!keep.log",
+	})
+	require.NoError(t, err)
+	require.NoError(t, m.AddFile("sub", []byte("# comment\n\n/local.html\n!important.swp\n")))
+
+	for _, tc := range []struct {
+		path     string
+		isDir    bool
+		expected bool
+	}{
+		{"page.html.swp", false, true},
+		{"a/b/page.html.swp", false, true},
+		{"node_modules", true, true},
+		{"lib/node_modules", true, true},
+		{"node_modules", false, false},
+		{"README.md", false, true},
+		{"docs/README.md", false, false},
+		{"drafts/a.yaml", false, true},
+		{"drafts/x/y/a.yaml", false, true},
+		{"drafts/a.json", false, false},
+		{"debug.log", false, true},
+		{"keep.log", false, false},
+		{"sub/local.html", false, true},
+		{"local.html", false, false},
+		{"sub/x/local.html", false, false},
+		{"sub/important.swp", false, false},
+		{"page.html", false, false},
+	} {
+		require.Equal(t, tc.expected, m.Match(tc.path, tc.isDir), tc.path)
+	}
+}
+
+func TestIgnoreFiles(t *testing.T) {
+	siteFS := mapFS(map[string]string{
+		"config.yaml": `
+ContentRoot: content
+SiteContentFile: site.yaml
+MappingFile: mapping.yaml
+TemplatesRoot: templates
+TemplatesType: go/template
+StaticRoot: static
+OutputRoot: output
+Ignore: ["*~", "node_modules/"]
+`,
+		"content/.incantignore": "old/\n",
+		"content/site.yaml":     `pages: "glob:pages/*.yaml"`,
+		"content/pages/a.yaml":  `name: a`,
+		"content/pages/b.yaml~": `name: backup`,
+		"content/mapping.yaml": `
+- PerMatchOutput: jq:.name + ".html"
+  Template: page.html
+  Selector: jq:.pages[]
+`,
+		// Would fail to load, since its template doesn't exist.
+		"content/old/mapping.yaml": `
+- SingleOutput: old.html
+  Template: old.html
+  Selector: jq:.
+`,
+		"templates/.incantignore":        "README.md\n",
+		"templates/page.html":            `{{.name}}`,
+		"templates/page.html~":           `{{.broken`,
+		"templates/README.md":            `{{.broken`,
+		"static/site.css":                `body {}`,
+		"static/node_modules/x/index.js": `x`,
+	})
+
+	result, err := processor.Build(context.Background(), processor.BuildOptions{
+		SiteFS:     siteFS,
+		ConfigPath: "config.yaml",
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a.html", "static/site.css"}, result.Outputs)
+}
+
+func TestMalformedIgnoreFile(t *testing.T) {
+	for _, root := range []string{"content", "templates", "static"} {
+		files := buildTestSite(map[string]string{"page.html": `{{.name}}`})
+		files["site/"+root+"/.incantignore"] = "# comment\n!\n"
+		result, err := processor.Build(context.Background(), processor.BuildOptions{
+			SiteFS:     mapFS(files),
+			ConfigPath: "site/config.yaml",
+		})
+		require.ErrorIs(t, err, processor.ErrBuildFailed, root)
+		require.Contains(t, result.Diagnostics[0].Message, "error in "+root+"/.incantignore: line 2: empty ignore pattern", root)
+	}
+}
@@ -0,0 +1,415 @@
+package processor
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// TemplateAnalyzer is implemented by TemplateMgrs which can statically report
+// what a template reads, without executing it.
+type TemplateAnalyzer interface {
+	Analyze(tmplName string) (TemplateUsage, error)
+}
+
+type TemplateUsage struct {
+	// FieldPaths are the paths read from the data passed to the template,
+	// including reads made by any templates it includes.
+	FieldPaths []FieldPath
+	// References are the names of the template files used by the template,
+	// directly or transitively.
+	References []string
+}
+
+// FieldPath is a sequence of field names, read starting from the template
+// data. The special segment "[]" stands for any element of a list, or any
+// value of a map, as produced by ranging over it.
+type FieldPath []string
+
+const elemSegment = "[]"
+
+func (fp FieldPath) String() string {
+	var b strings.Builder
+	for _, segment := range fp {
+		if segment == elemSegment {
+			b.WriteString(elemSegment)
+		} else {
+			b.WriteString(".")
+			b.WriteString(segment)
+		}
+	}
+	if b.Len() == 0 {
+		return "."
+	}
+	return b.String()
+}
+
+// child returns a copy of fp with segments appended. A nil path means the
+// location is unknown, and stays unknown.
+func (fp FieldPath) child(segments ...string) FieldPath {
+	if fp == nil {
+		return nil
+	}
+	newPath := make(FieldPath, 0, len(fp)+len(segments))
+	newPath = append(newPath, fp...)
+	return append(newPath, segments...)
+}
+
+// usageCollector accumulates a TemplateUsage across templates, and guards
+// against analyzing the same template with the same data twice.
+type usageCollector struct {
+	paths      map[string]FieldPath
+	references map[string]bool
+	visited    map[string]bool
+}
+
+func newUsageCollector() *usageCollector {
+	return &usageCollector{
+		map[string]FieldPath{},
+		map[string]bool{},
+		map[string]bool{},
+	}
+}
+
+func (uc *usageCollector) addPath(path FieldPath) {
+	if len(path) == 0 {
+		return
+	}
+	uc.paths[path.String()] = path
+}
+
+// visit reports whether the template should be analyzed with the given dot.
+func (uc *usageCollector) visit(tmplName string, dot FieldPath) bool {
+	key := fmt.Sprintf("%s|%t|%s", tmplName, dot == nil, dot.String())
+	if uc.visited[key] {
+		return false
+	}
+	uc.visited[key] = true
+	return true
+}
+
+func (uc *usageCollector) usage() TemplateUsage {
+	var usage TemplateUsage
+	for _, path := range uc.paths {
+		usage.FieldPaths = append(usage.FieldPaths, path)
+	}
+	sort.Slice(usage.FieldPaths, func(i, j int) bool {
+		return usage.FieldPaths[i].String() < usage.FieldPaths[j].String()
+	})
+	for reference := range uc.references {
+		usage.References = append(usage.References, reference)
+	}
+	sort.Strings(usage.References)
+	return usage
+}
+
+// Shape describes the structure of template data: which fields exist, and
+// what can be ranged over. It is inferred either from example values, or
+// from a Go type.
+type Shape struct {
+	// Any means nothing is known about the value, so every path is allowed.
+	Any bool
+	// Fields are the known keys of maps, or fields and methods of structs.
+	Fields map[string]*Shape
+	// AnyKey describes the values of maps whose keys aren't known statically.
+	AnyKey *Shape
+	// Elem describes the elements of lists.
+	Elem *Shape
+
+	// isInferred means the shape was inferred from values, numValues of them.
+	// An inferred shape of no values, such as the elements of an empty list,
+	// says nothing about the data.
+	isInferred bool
+	numValues  int
+	// numMaps counts the maps among those values, and fieldCounts how many of
+	// the maps have each field. Templates fail on fields some maps lack.
+	numMaps     int
+	fieldCounts map[string]int
+}
+
+func newShape() *Shape {
+	return &Shape{Fields: map[string]*Shape{}}
+}
+
+// ShapeOf infers the union of the shapes of the given values.
+func ShapeOf(values ...any) *Shape {
+	shape := newShape()
+	shape.isInferred = true
+	for _, value := range values {
+		shape.addValue(value)
+	}
+	return shape
+}
+
+func (s *Shape) addValue(value any) {
+	s.numValues++
+	switch typed := value.(type) {
+	case map[string]any:
+		s.numMaps++
+		if s.fieldCounts == nil {
+			s.fieldCounts = map[string]int{}
+		}
+		for key, fieldValue := range typed {
+			fieldShape, hasField := s.Fields[key]
+			if !hasField {
+				fieldShape = newShape()
+				fieldShape.isInferred = true
+				s.Fields[key] = fieldShape
+			}
+			fieldShape.addValue(fieldValue)
+			s.fieldCounts[key]++
+		}
+	case []any:
+		if s.Elem == nil {
+			s.Elem = newShape()
+			s.Elem.isInferred = true
+		}
+		for _, elem := range typed {
+			s.Elem.addValue(elem)
+		}
+	default:
+		// Decoders produce some struct values, e.g. TOML dates as time.Time,
+		// whose methods templates can call.
+		if value != nil && reflect.TypeOf(value).Kind() == reflect.Struct {
+			s.merge(ShapeOfType(reflect.TypeOf(value)))
+		}
+	}
+}
+
+// ShapeOfType describes the data reachable from a value of type t.
+func ShapeOfType(t reflect.Type) *Shape {
+	return shapeOfType(t, map[reflect.Type]*Shape{})
+}
+
+func shapeOfType(t reflect.Type, seen map[reflect.Type]*Shape) *Shape {
+	if shape, isSeen := seen[t]; isSeen {
+		return shape
+	}
+
+	shape := newShape()
+	seen[t] = shape
+
+	// Methods are callable on both the value and the pointer, as far as the
+	// template engines are concerned, when the data is addressable. Be
+	// lenient and accept both.
+	methodSource := t
+	if t.Kind() != reflect.Pointer && t.Kind() != reflect.Interface {
+		methodSource = reflect.PointerTo(t)
+	}
+	for i := 0; i < methodSource.NumMethod(); i++ {
+		method := methodSource.Method(i)
+		if method.Type.NumOut() > 0 {
+			shape.Fields[method.Name] = shapeOfType(method.Type.Out(0), seen)
+		} else {
+			shape.Fields[method.Name] = &Shape{Any: true}
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		elemShape := shapeOfType(t.Elem(), seen)
+		for name, fieldShape := range elemShape.Fields {
+			shape.Fields[name] = fieldShape
+		}
+		shape.Any = elemShape.Any
+		shape.AnyKey = elemShape.AnyKey
+		shape.Elem = elemShape.Elem
+	case reflect.Interface:
+		shape.Any = true
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.IsExported() {
+				shape.Fields[field.Name] = shapeOfType(field.Type, seen)
+			}
+		}
+	case reflect.Map:
+		shape.AnyKey = shapeOfType(t.Elem(), seen)
+	case reflect.Slice, reflect.Array:
+		shape.Elem = shapeOfType(t.Elem(), seen)
+	}
+	return shape
+}
+
+// elemShape returns the shape of the values produced by ranging over s.
+func (s *Shape) elemShape() *Shape {
+	switch {
+	case s.Elem != nil:
+		return s.Elem
+	case s.AnyKey != nil:
+		return s.AnyKey
+	case len(s.Fields) > 0:
+		union := newShape()
+		for _, fieldShape := range s.Fields {
+			union.merge(fieldShape)
+		}
+		return union
+	default:
+		return nil
+	}
+}
+
+func (s *Shape) merge(other *Shape) {
+	s.mergeOnce(other, map[*Shape]bool{})
+}
+
+// mergeOnce guards against shapes of recursive Go types, which are cyclic.
+func (s *Shape) mergeOnce(other *Shape, merged map[*Shape]bool) {
+	if merged[other] {
+		return
+	}
+	merged[other] = true
+
+	s.Any = s.Any || other.Any
+	s.isInferred = s.isInferred || other.isInferred
+	s.numValues += other.numValues
+	s.numMaps += other.numMaps
+	for name, count := range other.fieldCounts {
+		if s.fieldCounts == nil {
+			s.fieldCounts = map[string]int{}
+		}
+		s.fieldCounts[name] += count
+	}
+	for name, fieldShape := range other.Fields {
+		existing, hasField := s.Fields[name]
+		if !hasField {
+			existing = newShape()
+			s.Fields[name] = existing
+		}
+		existing.mergeOnce(fieldShape, merged)
+	}
+	if other.AnyKey != nil {
+		if s.AnyKey == nil {
+			s.AnyKey = newShape()
+		}
+		s.AnyKey.mergeOnce(other.AnyKey, merged)
+	}
+	if other.Elem != nil {
+		if s.Elem == nil {
+			s.Elem = newShape()
+		}
+		s.Elem.mergeOnce(other.Elem, merged)
+	}
+}
+
+// isUnknown reports whether nothing is known about the data, so every path
+// is allowed.
+func (s *Shape) isUnknown() bool {
+	return s.Any || (s.isInferred && s.numValues == 0)
+}
+
+// Check returns an error if path cannot be read from data of this shape. Map
+// fields must be in every map, since reading a missing key fails.
+func (s *Shape) Check(path FieldPath) error {
+	current := s
+	for i, segment := range path {
+		if current.isUnknown() {
+			return nil
+		}
+
+		var next *Shape
+		if segment == elemSegment {
+			next = current.elemShape()
+			if next == nil {
+				return fmt.Errorf("cannot range over %s", path[:i].String())
+			}
+		} else {
+			next = current.Fields[segment]
+			if next == nil {
+				next = current.AnyKey
+			}
+			if next == nil {
+				return fmt.Errorf("undefined field %s", path[:i+1].String())
+			}
+			if current.numMaps > 0 && current.fieldCounts[segment] < current.numMaps {
+				return fmt.Errorf("field %s is missing from %d of %d values", path[:i+1].String(), current.numMaps-current.fieldCounts[segment], current.numMaps)
+			}
+		}
+		current = next
+	}
+	return nil
+}
+
+func (p *processor) Lint(allMappings []MappingForTemplate, siteContent any) bool {
+	Printfln("\nLINTING TEMPLATES...")
+
+	hasError := false
+	usedTemplates := map[string]bool{}
+	for _, mapping := range allMappings {
+		if mapping.Template == "" {
+			continue
+		}
+
+		dataShape, newError := p.mappingDataShape(mapping, siteContent)
+		hasError = hasError || newError
+
+		analyzer, canAnalyze := p.templates.MgrFor(mapping.Template).(TemplateAnalyzer)
+		if !canAnalyze {
+			hasError = p.diags.errorfln("TemplatesType %q of template %q does not support linting", p.templates.TypeFor(mapping.Template), mapping.Template)
+			continue
+		}
+
+		usage, err := analyzer.Analyze(mapping.Template)
+		if err != nil {
+			hasError = p.diags.errorfln("error analyzing template %q: %s", mapping.Template, err.Error())
+			continue
+		}
+
+		usedTemplates[mapping.Template] = true
+		for _, reference := range usage.References {
+			usedTemplates[reference] = true
+		}
+
+		for _, path := range usage.FieldPaths {
+			err := dataShape.Check(path)
+			if err != nil {
+				hasError = p.diags.errorfln("template %q, used with selector %q: %s", mapping.Template, mapping.Selector, err.Error())
+			}
+		}
+	}
+
+	templateNames, err := p.templatesLoader.FindFiles()
+	if err != nil {
+		return p.diags.errorfln("error listing templates: %s", err.Error())
+	}
+	for _, templateName := range templateNames {
+		// Shortcode templates are used by content, not mappings.
+		if !usedTemplates[templateName] && !strings.HasPrefix(templateName, ShortcodesDir) {
+			p.diags.warnfln("warning: template %q is not used by any mapping", templateName)
+		}
+	}
+
+	return hasError
+}
+
+// mappingDataShape describes the data that processOneMapping would pass to
+// the mapping's template.
+func (p *processor) mappingDataShape(mapping MappingForTemplate, siteContent any) (*Shape, bool) {
+	itemMatches, hasError := p.selectMatches(mapping, siteContent)
+
+	var itemShape *Shape
+	if mapping.Type != "" {
+		itemShape = ShapeOfType(p.types[mapping.Type])
+	} else {
+		if len(itemMatches) == 0 {
+			p.diags.warnfln("warning: selector %q has no matches, so the fields template %q reads from them can't be checked", mapping.Selector, mapping.Template)
+		}
+		itemShape = ShapeOf(itemMatches...)
+	}
+
+	switch {
+	case mapping.Aliases != "":
+		shape := newShape()
+		shape.Fields["From"] = newShape()
+		shape.Fields["To"] = newShape()
+		shape.Fields["Item"] = itemShape
+		return shape, hasError
+	case mapping.SingleOutput != "":
+		shape := newShape()
+		shape.Elem = itemShape
+		return shape, hasError
+	default:
+		return itemShape, hasError
+	}
+}
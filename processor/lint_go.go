@@ -0,0 +1,150 @@
+package processor
+
+import (
+	"fmt"
+	"text/template/parse"
+)
+
+func (tm *goTemplateMgr[T]) Analyze(tmplName string) (TemplateUsage, error) {
+	set, err := tm.pageSet(tmplName)
+	if err != nil {
+		return TemplateUsage{}, err
+	}
+	if tm.treeOf(set.Lookup(tmplName)) == nil {
+		return TemplateUsage{}, fmt.Errorf("template %q not found", tmplName)
+	}
+
+	uc := newUsageCollector()
+	a := goAnalysis{
+		uc,
+		func(name string) *parse.Tree {
+			return tm.treeOf(set.Lookup(name))
+		},
+		func(name string) string {
+			return tm.fileOf(tmplName, name)
+		},
+	}
+	a.analyzeTemplate(tmplName, FieldPath{})
+	return uc.usage(), nil
+}
+
+type goAnalysis struct {
+	uc *usageCollector
+	// lookupTree and fileOf resolve template names within the set of the page
+	// being analyzed, since each page has its own set of templates.
+	lookupTree func(name string) *parse.Tree
+	fileOf     func(name string) string
+}
+
+func (a goAnalysis) analyzeTemplate(tmplName string, dot FieldPath) {
+	if !a.uc.visit(tmplName, dot) {
+		return
+	}
+	a.uc.references[a.fileOf(tmplName)] = true
+
+	tree := a.lookupTree(tmplName)
+	if tree == nil {
+		return
+	}
+
+	a.walk(tree.Root, dot, map[string]FieldPath{"$": dot})
+}
+
+func (a goAnalysis) walk(node parse.Node, dot FieldPath, vars map[string]FieldPath) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		scope := copyVars(vars)
+		for _, child := range n.Nodes {
+			a.walk(child, dot, scope)
+		}
+	case *parse.ActionNode:
+		a.pipe(n.Pipe, dot, vars, true)
+	case *parse.IfNode:
+		a.pipe(n.Pipe, dot, vars, true)
+		a.walk(n.List, dot, vars)
+		a.walk(n.ElseList, dot, vars)
+	case *parse.WithNode:
+		withDot := a.pipe(n.Pipe, dot, vars, true)
+		a.walk(n.List, withDot, vars)
+		a.walk(n.ElseList, dot, vars)
+	case *parse.RangeNode:
+		rangePath := a.pipe(n.Pipe, dot, vars, false)
+		elemPath := rangePath.child(elemSegment)
+		a.uc.addPath(elemPath)
+		scope := copyVars(vars)
+		switch len(n.Pipe.Decl) {
+		case 1:
+			scope[n.Pipe.Decl[0].Ident[0]] = elemPath
+		case 2:
+			scope[n.Pipe.Decl[0].Ident[0]] = nil
+			scope[n.Pipe.Decl[1].Ident[0]] = elemPath
+		}
+		a.walk(n.List, elemPath, scope)
+		a.walk(n.ElseList, dot, vars)
+	case *parse.TemplateNode:
+		var templateDot FieldPath
+		if n.Pipe != nil {
+			templateDot = a.pipe(n.Pipe, dot, vars, false)
+		}
+		a.analyzeTemplate(n.Name, templateDot)
+	}
+}
+
+// pipe records the reads made by a pipeline, and returns the path of its
+// result, if the result is simply a read of the data.
+func (a goAnalysis) pipe(pipe *parse.PipeNode, dot FieldPath, vars map[string]FieldPath, declare bool) FieldPath {
+	if pipe == nil {
+		return nil
+	}
+
+	var result FieldPath
+	for _, cmd := range pipe.Cmds {
+		for _, arg := range cmd.Args {
+			result = a.arg(arg, dot, vars)
+		}
+	}
+	if len(pipe.Cmds) != 1 || len(pipe.Cmds[0].Args) != 1 {
+		result = nil
+	}
+
+	if declare {
+		for _, decl := range pipe.Decl {
+			vars[decl.Ident[0]] = result
+		}
+	}
+	return result
+}
+
+func (a goAnalysis) arg(node parse.Node, dot FieldPath, vars map[string]FieldPath) FieldPath {
+	switch n := node.(type) {
+	case *parse.DotNode:
+		return dot
+	case *parse.FieldNode:
+		path := dot.child(n.Ident...)
+		a.uc.addPath(path)
+		return path
+	case *parse.VariableNode:
+		path := vars[n.Ident[0]].child(n.Ident[1:]...)
+		a.uc.addPath(path)
+		return path
+	case *parse.ChainNode:
+		path := a.arg(n.Node, dot, vars).child(n.Field...)
+		a.uc.addPath(path)
+		return path
+	case *parse.PipeNode:
+		return a.pipe(n, dot, vars, false)
+	default:
+		return nil
+	}
+}
+
+func copyVars(vars map[string]FieldPath) map[string]FieldPath {
+	newVars := make(map[string]FieldPath, len(vars))
+	for name, path := range vars {
+		newVars[name] = path
+	}
+	return newVars
+}
@@ -0,0 +1,257 @@
+package processor
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/CloudyKit/jet/v6"
+)
+
+// The jet parser resolves extends and import statements without keeping them
+// in the exported tree, so find them in the template text instead.
+var jetExtendsImportRegexp = regexp.MustCompile(`\{\{-?\s*(?:extends|import)\s+"([^"]+)"`)
+
+func (tm *jetTemplateMgr) Analyze(tmplName string) (TemplateUsage, error) {
+	_, err := tm.set.GetTemplate(tmplName)
+	if err != nil {
+		return TemplateUsage{}, err
+	}
+
+	uc := newUsageCollector()
+	tm.analyzeTemplate(uc, tmplName, FieldPath{})
+	return uc.usage(), nil
+}
+
+func (tm *jetTemplateMgr) analyzeTemplate(uc *usageCollector, tmplName string, dot FieldPath) {
+	tmplName = strings.TrimPrefix(tmplName, "/")
+	if !uc.visit(tmplName, dot) {
+		return
+	}
+	uc.references[tmplName] = true
+
+	tmpl, err := tm.set.GetTemplate(tmplName)
+	if err != nil {
+		return
+	}
+
+	a := jetAnalysis{tm, uc, tmplName}
+	a.walk(tmpl.Root, dot, map[string]FieldPath{})
+
+	// Extended and imported templates execute with the same context.
+	for _, match := range jetExtendsImportRegexp.FindAllSubmatch(tm.loader[tmplName], -1) {
+		tm.analyzeTemplate(uc, a.resolveName(string(match[1])), dot)
+	}
+}
+
+type jetAnalysis struct {
+	tm       *jetTemplateMgr
+	uc       *usageCollector
+	tmplName string
+}
+
+// resolveName mirrors jet's lookup of template names, which are relative to
+// the referencing template unless they start with "/".
+func (a jetAnalysis) resolveName(name string) string {
+	if strings.HasPrefix(name, "/") {
+		return strings.TrimPrefix(name, "/")
+	}
+	relative := path.Join(path.Dir(a.tmplName), name)
+	if a.tm.loader.Exists(relative) {
+		return relative
+	}
+	return name
+}
+
+func (a jetAnalysis) walk(node jet.Node, dot FieldPath, vars map[string]FieldPath) {
+	switch n := node.(type) {
+	case *jet.ListNode:
+		if n == nil {
+			return
+		}
+		scope := copyVars(vars)
+		for _, child := range n.Nodes {
+			a.walk(child, dot, scope)
+		}
+	case *jet.ActionNode:
+		a.set(n.Set, dot, vars)
+		if n.Pipe != nil {
+			a.pipe(n.Pipe, dot, vars)
+		}
+	case *jet.IfNode:
+		scope := copyVars(vars)
+		a.set(n.Set, dot, scope)
+		a.expr(n.Expression, dot, scope)
+		a.walk(n.List, dot, scope)
+		a.walk(n.ElseList, dot, scope)
+	case *jet.RangeNode:
+		scope := copyVars(vars)
+		rangeDot := dot
+		if n.Set != nil {
+			elemPath := a.expr(n.Set.Right[0], dot, vars).child(elemSegment)
+			a.uc.addPath(elemPath)
+			switch len(n.Set.Left) {
+			case 1:
+				// A single variable receives the index or key, and the
+				// context becomes the value.
+				scope[n.Set.Left[0].String()] = nil
+				rangeDot = elemPath
+			case 2:
+				scope[n.Set.Left[0].String()] = nil
+				scope[n.Set.Left[1].String()] = elemPath
+			}
+		} else {
+			rangeDot = a.expr(n.Expression, dot, vars).child(elemSegment)
+			a.uc.addPath(rangeDot)
+		}
+		a.walk(n.List, rangeDot, scope)
+		a.walk(n.ElseList, dot, vars)
+	case *jet.BlockNode:
+		scope := a.parameters(n.Parameters, dot, vars)
+		blockDot := dot
+		if n.Expression != nil {
+			blockDot = a.expr(n.Expression, dot, vars)
+		}
+		a.walk(n.List, blockDot, scope)
+		a.walk(n.Content, dot, vars)
+	case *jet.YieldNode:
+		a.parameters(n.Parameters, dot, vars)
+		if n.Expression != nil {
+			a.expr(n.Expression, dot, vars)
+		}
+		a.walk(n.Content, dot, vars)
+	case *jet.IncludeNode:
+		includeDot := dot
+		if n.Context != nil {
+			includeDot = a.expr(n.Context, dot, vars)
+		}
+		nameNode, isString := n.Name.(*jet.StringNode)
+		if isString {
+			a.tm.analyzeTemplate(a.uc, a.resolveName(nameNode.Text), includeDot)
+		} else {
+			a.expr(n.Name, dot, vars)
+		}
+	case *jet.TryNode:
+		a.walk(n.List, dot, vars)
+		if n.Catch != nil {
+			a.walk(n.Catch.List, dot, vars)
+		}
+	case *jet.ReturnNode:
+		a.expr(n.Value, dot, vars)
+	}
+}
+
+func (a jetAnalysis) parameters(params *jet.BlockParameterList, dot FieldPath, vars map[string]FieldPath) map[string]FieldPath {
+	scope := copyVars(vars)
+	if params == nil {
+		return scope
+	}
+	for _, param := range params.List {
+		var paramPath FieldPath
+		if param.Expression != nil {
+			paramPath = a.expr(param.Expression, dot, vars)
+		}
+		if param.Identifier != "" {
+			scope[param.Identifier] = paramPath
+		}
+	}
+	return scope
+}
+
+func (a jetAnalysis) set(set *jet.SetNode, dot FieldPath, vars map[string]FieldPath) {
+	if set == nil {
+		return
+	}
+	for i, right := range set.Right {
+		rightPath := a.expr(right, dot, vars)
+		if i >= len(set.Left) {
+			continue
+		}
+		_, isIdentifier := set.Left[i].(*jet.IdentifierNode)
+		if isIdentifier {
+			vars[set.Left[i].String()] = rightPath
+		}
+	}
+}
+
+// pipe records the reads made by a pipeline, and returns the path of its
+// result, if the result is simply a read of the data.
+func (a jetAnalysis) pipe(pipe *jet.PipeNode, dot FieldPath, vars map[string]FieldPath) FieldPath {
+	var result FieldPath
+	for _, cmd := range pipe.Cmds {
+		result = a.expr(cmd.BaseExpr, dot, vars)
+		for _, arg := range cmd.Exprs {
+			a.expr(arg, dot, vars)
+		}
+	}
+	if len(pipe.Cmds) != 1 || pipe.Cmds[0].Exprs != nil {
+		return nil
+	}
+	return result
+}
+
+func (a jetAnalysis) expr(node jet.Node, dot FieldPath, vars map[string]FieldPath) FieldPath {
+	switch n := node.(type) {
+	case *jet.IdentifierNode:
+		if n.Ident == "." {
+			return dot
+		}
+		// Anything that isn't a variable is a function or global.
+		return vars[n.Ident]
+	case *jet.FieldNode:
+		path := dot.child(n.Ident...)
+		a.uc.addPath(path)
+		return path
+	case *jet.ChainNode:
+		path := a.expr(n.Node, dot, vars).child(n.Field...)
+		a.uc.addPath(path)
+		return path
+	case *jet.IndexExprNode:
+		base := a.expr(n.Base, dot, vars)
+		a.expr(n.Index, dot, vars)
+		var path FieldPath
+		key, isString := n.Index.(*jet.StringNode)
+		if isString {
+			path = base.child(key.Text)
+		} else {
+			path = base.child(elemSegment)
+		}
+		a.uc.addPath(path)
+		return path
+	case *jet.SliceExprNode:
+		base := a.expr(n.Base, dot, vars)
+		a.expr(n.Index, dot, vars)
+		a.expr(n.EndIndex, dot, vars)
+		return base
+	case *jet.CallExprNode:
+		a.expr(n.BaseExpr, dot, vars)
+		for _, arg := range n.Exprs {
+			a.expr(arg, dot, vars)
+		}
+		return nil
+	case *jet.PipeNode:
+		return a.pipe(n, dot, vars)
+	case *jet.AdditiveExprNode:
+		a.expr(n.Left, dot, vars)
+		a.expr(n.Right, dot, vars)
+	case *jet.MultiplicativeExprNode:
+		a.expr(n.Left, dot, vars)
+		a.expr(n.Right, dot, vars)
+	case *jet.LogicalExprNode:
+		a.expr(n.Left, dot, vars)
+		a.expr(n.Right, dot, vars)
+	case *jet.ComparativeExprNode:
+		a.expr(n.Left, dot, vars)
+		a.expr(n.Right, dot, vars)
+	case *jet.NumericComparativeExprNode:
+		a.expr(n.Left, dot, vars)
+		a.expr(n.Right, dot, vars)
+	case *jet.NotExprNode:
+		a.expr(n.Expr, dot, vars)
+	case *jet.TernaryExprNode:
+		a.expr(n.Boolean, dot, vars)
+		a.expr(n.Left, dot, vars)
+		a.expr(n.Right, dot, vars)
+	}
+	return nil
+}
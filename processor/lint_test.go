@@ -0,0 +1,97 @@
+package processor_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/treaster/incant/processor"
+
+	"github.com/stretchr/testify/require"
+)
+
+func analyze(t *testing.T, mgr processor.TemplateMgr, templates map[string]string, tmplName string) processor.TemplateUsage {
+	for name, body := range templates {
+		require.NoError(t, mgr.ParseOne(name, []byte(body)))
+	}
+	usage, err := mgr.(processor.TemplateAnalyzer).Analyze(tmplName)
+	require.NoError(t, err)
+	return usage
+}
+
+func pathStrings(usage processor.TemplateUsage) []string {
+	var result []string
+	for _, path := range usage.FieldPaths {
+		result = append(result, path.String())
+	}
+	return result
+}
+
+func TestAnalyzeGoTemplate(t *testing.T) {
+	usage := analyze(t, processor.GoTemplateMgr(processor.TemplateMgrOptions{}), map[string]string{
+		"index.html":          `{{range $i, $r := .}}{{$r.title}}{{template "card" $r}}{{end}}{{with .site}}{{.name}}{{end}}`,
+		"_partials/card.html": `{{define "card"}}<img src="{{.thumbnail}}">{{end}}`,
+		"unused.html":         `{{.nothing}}`,
+	}, "index.html")
+
+	require.Equal(t, []string{".site", ".site.name", "[]", "[].thumbnail", "[].title"}, pathStrings(usage))
+	require.Equal(t, []string{"_partials/card.html", "index.html"}, usage.References)
+}
+
+func TestAnalyzeJetTemplate(t *testing.T) {
+	usage := analyze(t, processor.JetTemplateMgr(processor.TemplateMgrOptions{}), map[string]string{
+		"index.html": `{{ range _, match := . }}{{ match.title }}{{ include "card.html" match }}{{ end }}{{ RenderMarkdown(.intro) }}`,
+		"card.html":  `{{ .thumbnail }}{{ range .tags }}{{ .label }}{{ end }}`,
+	}, "index.html")
+
+	require.Equal(t, []string{".intro", "[]", "[].tags", "[].tags[]", "[].tags[].label", "[].thumbnail", "[].title"}, pathStrings(usage))
+	require.Equal(t, []string{"card.html", "index.html"}, usage.References)
+}
+
+func TestShapeCheck(t *testing.T) {
+	shape := processor.ShapeOf(
+		map[string]any{"title": "a", "tags": []any{map[string]any{"label": "x"}}},
+		map[string]any{"title": "b", "tags": []any{}, "extra": 1},
+	)
+
+	require.NoError(t, shape.Check(processor.FieldPath{"title"}))
+	require.EqualError(t, shape.Check(processor.FieldPath{"extra"}), "field .extra is missing from 1 of 2 values")
+	require.NoError(t, shape.Check(processor.FieldPath{"tags", "[]", "label"}))
+	require.EqualError(t, shape.Check(processor.FieldPath{"tags", "[]", "name"}), "undefined field .tags[].name")
+	require.EqualError(t, shape.Check(processor.FieldPath{"title", "[]"}), "cannot range over .title")
+
+	// Nothing is known about the items of empty lists.
+	empty := processor.ShapeOf(map[string]any{"pages": []any{}})
+	require.NoError(t, empty.Check(processor.FieldPath{"pages", "[]", "name"}))
+	require.NoError(t, processor.ShapeOf().Check(processor.FieldPath{"name"}))
+
+	typed := processor.ShapeOfType(reflect.TypeOf(testRecipe{}))
+	require.NoError(t, typed.Check(processor.FieldPath{"Title"}))
+	require.NoError(t, typed.Check(processor.FieldPath{"URL"}))
+	require.NoError(t, typed.Check(processor.FieldPath{"Tags", "[]"}))
+	require.EqualError(t, typed.Check(processor.FieldPath{"title"}), "undefined field .title")
+}
+
+func TestLintOptionalFields(t *testing.T) {
+	lint := func(content string) *processor.BuildResult {
+		files := buildTestSite(map[string]string{"page.html": `{{.name}} {{.extra}}`})
+		files["site/content/site.yaml"] = content
+		result, _ := processor.Lint(context.Background(), processor.BuildOptions{
+			SiteFS:     mapFS(files),
+			ConfigPath: "site/config.yaml",
+		})
+		return result
+	}
+
+	// Building would fail on the page without extra.
+	result := lint(`pages: [{name: a, extra: x}, {name: b}]`)
+	require.Equal(t, 1, len(result.Diagnostics))
+	require.Equal(t, processor.SeverityError, result.Diagnostics[0].Severity)
+	require.Contains(t, result.Diagnostics[0].Message, "field .extra is missing from 1 of 2 values")
+
+	// With no pages, building succeeds, and nothing can be checked.
+	result = lint(`pages: []`)
+	require.Equal(t, []processor.Diagnostic{
+		{processor.PhaseLint, processor.SeverityWarning, `warning: selector "jq:.pages[]" has no matches, so the fields template "page.html" reads from them can't be checked`},
+	}, result.Diagnostics)
+}
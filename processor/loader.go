@@ -1,8 +1,14 @@
 package processor
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/fs"
+	"path"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
 
 	"github.com/BurntSushi/toml"
 	"github.com/hjson/hjson-go/v4"
@@ -10,28 +16,89 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
-func MakeFileLoader(siteRoot string, relativeDir string, readFileFn func(string) ([]byte, error)) FileLoader {
-	baseDir := filepath.Clean(filepath.Join(siteRoot, relativeDir)) + "/"
+// Decoder decodes the bytes of a content file into output, a pointer as
+// passed to json.Unmarshal. options is the query string following the file
+// path, e.g. "infer=true" for "prices.csv?infer=true", or "" if there is none.
+type Decoder func(data []byte, output any, options string) error
+
+// UnmarshalDecoder adapts an unmarshal function, such as json.Unmarshal, into
+// a Decoder which accepts no options.
+func UnmarshalDecoder(unmarshal func([]byte, any) error) Decoder {
+	return func(data []byte, output any, options string) error {
+		if options != "" {
+			return fmt.Errorf("this format takes no options, got %q", options)
+		}
+		return unmarshal(data, output)
+	}
+}
+
+// TabularDecoder decodes CSV-like files with DecodeTabular, taking
+// TabularOptions from the query string.
+func TabularDecoder(defaultDelimiter rune) Decoder {
+	return func(data []byte, output any, options string) error {
+		opts, err := ParseTabularOptions(options, defaultDelimiter)
+		if err != nil {
+			return err
+		}
+		rows, err := DecodeTabular(data, opts)
+		if err != nil {
+			return err
+		}
+		return assignDecoded(rows, output)
+	}
+}
+
+// DefaultDecoders returns the built-in decoders, keyed by file extension.
+// Programs embedding incant can add their own before passing them to Load.
+func DefaultDecoders() map[string]Decoder {
+	return map[string]Decoder{
+		".yaml": UnmarshalDecoder(yaml.Unmarshal),
+		".yml":  UnmarshalDecoder(yaml.Unmarshal),
+		".json": UnmarshalDecoder(json.Unmarshal),
+		".toml": UnmarshalDecoder(func(fileBytes []byte, output any) error {
+			_, err := toml.Decode(string(fileBytes), output)
+			return err
+		}),
+		".json5": UnmarshalDecoder(json5.Unmarshal),
+		".hjson": UnmarshalDecoder(hjson.Unmarshal),
+		".csv":   TabularDecoder(','),
+		".tsv":   TabularDecoder('\t'),
+	}
+}
+
+// MakeFileLoader returns a loader for the files beneath relativeDir in fsys.
+// Like all fs.FS paths, relativeDir is slash-separated and unrooted.
+func MakeFileLoader(fsys fs.FS, relativeDir string, decoders map[string]Decoder) FileLoader {
 	return FileLoader{
-		baseDir:    baseDir,
-		readFileFn: readFileFn,
-		typesMap: map[string]func([]byte, any) error{
-			".yaml": yaml.Unmarshal,
-			".toml": func(fileBytes []byte, output any) error {
-				_, err := toml.Decode(string(fileBytes), output)
-				return err
-			},
-			".json5": json5.Unmarshal,
-			".hjson": hjson.Unmarshal,
-		},
+		fsys:     fsys,
+		baseDir:  path.Clean(filepath.ToSlash(relativeDir)),
+		decoders: decoders,
 	}
 }
 
 type FileLoader struct {
-	baseDir string
-	// e.g. os.ReadFile
-	readFileFn func(string) ([]byte, error)
-	typesMap   map[string]func([]byte, any) error
+	// e.g. os.DirFS(siteRoot)
+	fsys     fs.FS
+	baseDir  string
+	decoders map[string]Decoder
+	// ignore holds the patterns of files skipped when finding files.
+	ignore *IgnoreMatcher
+	// exec runs the commands of exec: references, if they are enabled.
+	exec *ExecRunner
+}
+
+// WithIgnore returns a copy of the loader which skips files matching ignore
+// when finding files. Files can still be loaded by name.
+func (l FileLoader) WithIgnore(ignore *IgnoreMatcher) FileLoader {
+	l.ignore = ignore
+	return l
+}
+
+// WithExec returns a copy of the loader which evaluates exec: references
+// with runner.
+func (l FileLoader) WithExec(runner *ExecRunner) FileLoader {
+	l.exec = runner
+	return l
 }
 
 func (l FileLoader) BaseDir() string {
@@ -39,52 +106,142 @@ func (l FileLoader) BaseDir() string {
 }
 
 func (l FileLoader) SupportsFormat(s string) bool {
-	ext := filepath.Ext(s)
-	_, hasFormat := l.typesMap[ext]
+	filePath, _ := l.splitOptions(s)
+	_, hasFormat := l.decoders[filepath.Ext(filePath)]
 	return hasFormat
 }
 
+// fileOptionsPattern matches decoder options, e.g. "delimiter=;&infer=true".
+var fileOptionsPattern = regexp.MustCompile(`^[^&=]+=[^&]*(&[^&=]+=[^&]*)*$`)
+
+// splitOptions splits a file path from the decoder options after its last
+// "?". The path is only split if what follows looks like options, and what
+// precedes has a supported extension, so file names may contain "?".
+func (l FileLoader) splitOptions(s string) (string, string) {
+	i := strings.LastIndex(s, "?")
+	if i < 0 || !fileOptionsPattern.MatchString(s[i+1:]) {
+		return s, ""
+	}
+	_, hasFormat := l.decoders[filepath.Ext(s[:i])]
+	if !hasFormat {
+		return s, ""
+	}
+	return s[:i], s[i+1:]
+}
+
 func (l FileLoader) LoadFileAsBytes(s string) ([]byte, error) {
-	fullPath := filepath.Join(l.baseDir, s)
-	return l.readFileFn(fullPath)
+	return fs.ReadFile(l.fsys, path.Join(l.baseDir, s))
 }
 
+// LoadFile decodes a file with the decoder for its extension. Options after a
+// "?" in the path are passed to the decoder, e.g. "prices.csv?infer=true".
 func (l FileLoader) LoadFile(s string, output any) error {
-	ext := filepath.Ext(s)
+	filePath, options := l.splitOptions(s)
+	ext := filepath.Ext(filePath)
+
+	_, hasFormat := l.decoders[ext]
+	if !hasFormat {
+		return fmt.Errorf("unsupported extension %q on file path %q; supported extensions are %s", ext, filePath, strings.Join(l.Extensions(), ", "))
+	}
 
-	fullPath := filepath.Join(l.baseDir, s)
-	fileBytes, err := l.readFileFn(fullPath)
+	fileBytes, err := l.LoadFileAsBytes(filePath)
 	if err != nil {
 		return err
 	}
 
-	fn, hasFormat := l.typesMap[ext]
+	return l.Decode(fileBytes, ext, output, options)
+}
+
+// Decode decodes data with the decoder for the extension ext, e.g. ".json".
+func (l FileLoader) Decode(data []byte, ext string, output any, options string) error {
+	decoder, hasFormat := l.decoders[ext]
 	if !hasFormat {
-		panic(fmt.Sprintf("Unknown extension on file path %q", s))
+		return fmt.Errorf("unsupported format %q; supported formats are %s", ext, strings.Join(l.Extensions(), ", "))
 	}
+	return decoder(data, output, options)
+}
 
-	return fn(fileBytes, output)
+// Extensions returns the supported file extensions, in sorted order.
+func (l FileLoader) Extensions() []string {
+	var exts []string
+	for ext := range l.decoders {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	return exts
 }
 
-func (l FileLoader) FindFilesWithName(targetName string) []string {
-	matches := FindFilesWithName(l.baseDir, targetName)
+func (l FileLoader) FindFilesWithName(targetName string) ([]string, error) {
+	matches, err := FindFilesWithName(l.fsys, l.baseDir, targetName, l.ignore)
+	if err != nil {
+		return nil, err
+	}
 	l.trimPrefixes(matches)
-	return matches
+	return matches, nil
 }
 
-func (l FileLoader) FindFiles() []string {
-	matches := FindFiles(l.baseDir)
+func (l FileLoader) FindFiles() ([]string, error) {
+	matches, err := FindFiles(l.fsys, l.baseDir, l.ignore)
+	if err != nil {
+		return nil, err
+	}
 	l.trimPrefixes(matches)
-	return matches
+	return matches, nil
 }
 
-func (l FileLoader) Copy(src string, dst string) error {
-	fullPath := filepath.Join(l.baseDir, src)
-	return Copy(fullPath, dst)
+// Glob returns the files under the base directory whose relative paths match
+// pattern, in sorted order. The pattern syntax is that of filepath.Match, so
+// "*" never matches across a "/".
+func (l FileLoader) Glob(pattern string) ([]string, error) {
+	_, err := filepath.Match(pattern, "")
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := l.FindFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []string
+	for _, file := range files {
+		isMatch, _ := filepath.Match(pattern, file)
+		if isMatch {
+			matches = append(matches, file)
+		}
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// FindFilesUnder returns the files beneath relDir, recursively and in sorted
+// order. Paths are relative to the base directory, not to relDir.
+func (l FileLoader) FindFilesUnder(relDir string) ([]string, error) {
+	prefix := filepath.Clean(relDir) + "/"
+	if prefix == "./" {
+		prefix = ""
+	}
+
+	files, err := l.FindFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []string
+	for _, file := range files {
+		if strings.HasPrefix(file, prefix) {
+			matches = append(matches, file)
+		}
+	}
+	sort.Strings(matches)
+	return matches, nil
 }
 
 func (l FileLoader) trimPrefixes(matches []string) {
+	if l.baseDir == "." {
+		return
+	}
 	for i, _ := range matches {
-		matches[i] = SafeCutPrefix(matches[i], l.baseDir)
+		matches[i] = SafeCutPrefix(matches[i], l.baseDir+"/")
 	}
 }
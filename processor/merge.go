@@ -0,0 +1,164 @@
+package processor
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	extendsKey = "$extends"
+	mergeKey   = "$merge"
+
+	mergeReplace = "replace"
+	mergeAppend  = "append"
+)
+
+// applyDirectives handles the $extends and $merge keys of an already-evaluated
+// content map. $extends names one or more base maps (usually via file:
+// references), which are deep-merged in order, with the map's own keys merged
+// last. Maps are merged key by key. Lists are replaced by default, which can
+// be changed with $merge: either a single strategy for every list, or a map of
+// dotted key paths to strategies.
+func applyDirectives(ctx *evalContext, content map[string]any) any {
+	extendsValue, hasExtends := content[extendsKey]
+	mergeValue, hasMerge := content[mergeKey]
+	if !hasExtends {
+		if hasMerge {
+			ctx.addError("%s is only valid alongside %s", mergeKey, extendsKey)
+		}
+		return content
+	}
+
+	override := map[string]any{}
+	for key, value := range content {
+		if key != extendsKey && key != mergeKey {
+			override[key] = value
+		}
+	}
+
+	strategies := mergeStrategies{defaultStrategy: mergeReplace}
+	if hasMerge {
+		var hasError bool
+		strategies, hasError = parseMergeStrategies(ctx, mergeValue)
+		if hasError {
+			return nil
+		}
+	}
+
+	var bases []any
+	switch typed := extendsValue.(type) {
+	case []any:
+		bases = typed
+	default:
+		bases = []any{typed}
+	}
+
+	var result any = map[string]any{}
+	for i, base := range bases {
+		baseMap, isMap := base.(map[string]any)
+		if !isMap {
+			ctx.addError("%s entry %d must be a map, got %T", extendsKey, i, base)
+			return nil
+		}
+		result = mergeValues(result, baseMap, "", strategies)
+	}
+
+	return mergeValues(result, override, "", strategies)
+}
+
+type mergeStrategies struct {
+	defaultStrategy string
+	byPath          map[string]string
+}
+
+func (ms mergeStrategies) forPath(path string) string {
+	strategy, hasStrategy := ms.byPath[path]
+	if hasStrategy {
+		return strategy
+	}
+	return ms.defaultStrategy
+}
+
+func parseMergeStrategies(ctx *evalContext, mergeValue any) (mergeStrategies, bool) {
+	strategies := mergeStrategies{
+		defaultStrategy: mergeReplace,
+		byPath:          map[string]string{},
+	}
+
+	validate := func(name string, value any) (string, bool) {
+		strategy, isString := value.(string)
+		if !isString || (strategy != mergeReplace && strategy != mergeAppend) {
+			ctx.addError("%s strategy for %s must be %q or %q, got %v", mergeKey, name, mergeReplace, mergeAppend, value)
+			return "", true
+		}
+		return strategy, false
+	}
+
+	switch typed := mergeValue.(type) {
+	case string:
+		strategy, hasError := validate("all lists", typed)
+		if hasError {
+			return strategies, true
+		}
+		strategies.defaultStrategy = strategy
+	case map[string]any:
+		hasError := false
+		for path, value := range typed {
+			strategy, newError := validate(fmt.Sprintf("%q", path), value)
+			hasError = hasError || newError
+			strategies.byPath[path] = strategy
+		}
+		if hasError {
+			return strategies, true
+		}
+	default:
+		ctx.addError("%s must be a string or a map, got %T", mergeKey, mergeValue)
+		return strategies, true
+	}
+
+	return strategies, false
+}
+
+// mergeValues deep-merges override onto base, without modifying either. Base
+// values may be shared with other content (file: results are cached), so any
+// container that changes is copied.
+func mergeValues(base any, override any, path string, strategies mergeStrategies) any {
+	switch overrideTyped := override.(type) {
+	case map[string]any:
+		baseMap, isMap := base.(map[string]any)
+		if !isMap {
+			return override
+		}
+		merged := make(map[string]any, len(baseMap)+len(overrideTyped))
+		for key, value := range baseMap {
+			merged[key] = value
+		}
+		for key, value := range overrideTyped {
+			baseValue, hasKey := merged[key]
+			if hasKey {
+				merged[key] = mergeValues(baseValue, value, joinMergePath(path, key), strategies)
+			} else {
+				merged[key] = value
+			}
+		}
+		return merged
+	case []any:
+		baseList, isList := base.([]any)
+		if !isList || strategies.forPath(path) != mergeAppend {
+			return override
+		}
+		merged := make([]any, 0, len(baseList)+len(overrideTyped))
+		merged = append(merged, baseList...)
+		merged = append(merged, overrideTyped...)
+		return merged
+	default:
+		return override
+	}
+}
+
+func joinMergePath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return strings.Join([]string{path, key}, ".")
+}
@@ -0,0 +1,234 @@
+package processor
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OutputSink receives the files produced by a build. Paths are slash-separated
+// and relative to the output root.
+type OutputSink interface {
+	// Clear removes any existing output.
+	Clear() error
+	WriteFile(relPath string, contents []byte) error
+	// Close finishes the output once every file is written.
+	Close() error
+}
+
+// NewOutputSink chooses a sink by the extension of outputPath. A path ending
+// in .zip builds a zip archive, .tar.gz or .tgz builds a gzipped tarball, and
+// anything else is a directory.
+func NewOutputSink(outputPath string) OutputSink {
+	lower := strings.ToLower(outputPath)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return NewZipSink(outputPath)
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return NewTarGzSink(outputPath)
+	default:
+		return NewDirSink(outputPath)
+	}
+}
+
+// DirSink writes output files beneath a directory on disk.
+type DirSink struct {
+	Root string
+}
+
+func NewDirSink(root string) *DirSink {
+	return &DirSink{root}
+}
+
+func (s *DirSink) Clear() error {
+	return os.RemoveAll(s.Root)
+}
+
+func (s *DirSink) WriteFile(relPath string, contents []byte) error {
+	outputPath := filepath.Join(s.Root, filepath.FromSlash(relPath))
+	err := os.MkdirAll(filepath.Dir(outputPath), 0755)
+	if err != nil {
+		return fmt.Errorf("error creating output directory: %s", err.Error())
+	}
+	return os.WriteFile(outputPath, contents, 0644)
+}
+
+func (s *DirSink) Close() error {
+	return nil
+}
+
+// MemorySink keeps output files in memory, keyed by their relative paths.
+type MemorySink struct {
+	Files map[string][]byte
+}
+
+func NewMemorySink() *MemorySink {
+	return &MemorySink{map[string][]byte{}}
+}
+
+func (s *MemorySink) Clear() error {
+	s.Files = map[string][]byte{}
+	return nil
+}
+
+func (s *MemorySink) WriteFile(relPath string, contents []byte) error {
+	s.Files[relPath] = append([]byte(nil), contents...)
+	return nil
+}
+
+func (s *MemorySink) Close() error {
+	return nil
+}
+
+// sortedPaths lists the files of the sink in path order, so that archives are
+// the same from one build to the next.
+func (s *MemorySink) sortedPaths() []string {
+	paths := make([]string, 0, len(s.Files))
+	for relPath := range s.Files {
+		paths = append(paths, relPath)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// archiveModTime is the modification time of every archived file. A fixed
+// time keeps archives of the same site identical.
+var archiveModTime = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// ZipSink collects output files in memory, and writes them to a zip archive
+// when closed.
+type ZipSink struct {
+	Path  string
+	files *MemorySink
+}
+
+func NewZipSink(archivePath string) *ZipSink {
+	return &ZipSink{archivePath, NewMemorySink()}
+}
+
+func (s *ZipSink) Clear() error {
+	return clearArchive(s.Path, s.files)
+}
+
+func (s *ZipSink) WriteFile(relPath string, contents []byte) error {
+	return s.files.WriteFile(relPath, contents)
+}
+
+func (s *ZipSink) Close() error {
+	return writeArchive(s.Path, func(w io.Writer) error {
+		archive := zip.NewWriter(w)
+		for _, relPath := range s.files.sortedPaths() {
+			header := &zip.FileHeader{
+				Name:     relPath,
+				Method:   zip.Deflate,
+				Modified: archiveModTime,
+			}
+			header.SetMode(0644)
+			entry, err := archive.CreateHeader(header)
+			if err != nil {
+				return err
+			}
+			_, err = entry.Write(s.files.Files[relPath])
+			if err != nil {
+				return err
+			}
+		}
+		return archive.Close()
+	})
+}
+
+// TarGzSink collects output files in memory, and writes them to a gzipped
+// tarball when closed.
+type TarGzSink struct {
+	Path  string
+	files *MemorySink
+}
+
+func NewTarGzSink(archivePath string) *TarGzSink {
+	return &TarGzSink{archivePath, NewMemorySink()}
+}
+
+func (s *TarGzSink) Clear() error {
+	return clearArchive(s.Path, s.files)
+}
+
+func (s *TarGzSink) WriteFile(relPath string, contents []byte) error {
+	return s.files.WriteFile(relPath, contents)
+}
+
+func (s *TarGzSink) Close() error {
+	return writeArchive(s.Path, func(w io.Writer) error {
+		compressed := gzip.NewWriter(w)
+		archive := tar.NewWriter(compressed)
+		for _, relPath := range s.files.sortedPaths() {
+			contents := s.files.Files[relPath]
+			err := archive.WriteHeader(&tar.Header{
+				Typeflag: tar.TypeReg,
+				Name:     relPath,
+				Mode:     0644,
+				Size:     int64(len(contents)),
+				ModTime:  archiveModTime,
+			})
+			if err != nil {
+				return err
+			}
+			_, err = archive.Write(contents)
+			if err != nil {
+				return err
+			}
+		}
+		err := archive.Close()
+		if err != nil {
+			return err
+		}
+		return compressed.Close()
+	})
+}
+
+func clearArchive(archivePath string, files *MemorySink) error {
+	err := files.Clear()
+	if err != nil {
+		return err
+	}
+	err = os.Remove(archivePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func writeArchive(archivePath string, write func(io.Writer) error) error {
+	err := os.MkdirAll(filepath.Dir(archivePath), 0755)
+	if err != nil {
+		return fmt.Errorf("error creating output directory: %s", err.Error())
+	}
+
+	f, err := os.Create(archivePath)
+	if err != nil {
+		return err
+	}
+	err = write(f)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("error writing archive %s: %s", archivePath, err.Error())
+	}
+	return f.Close()
+}
+
+// cleanOutputPath normalizes a path for an OutputSink, rejecting paths which
+// would escape the output root.
+func cleanOutputPath(relPath string) (string, error) {
+	cleaned := path.Clean("/" + filepath.ToSlash(relPath))[1:]
+	if cleaned == "" || strings.HasPrefix(path.Clean(filepath.ToSlash(relPath)), "../") {
+		return "", fmt.Errorf("invalid output path %q", relPath)
+	}
+	return cleaned, nil
+}
@@ -0,0 +1,113 @@
+package processor_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/treaster/incant/processor"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildInMemory(t *testing.T) {
+	siteFS := mapFS(map[string]string{
+		"config.yaml": `
+ContentRoot: content
+SiteContentFile: site.yaml
+MappingFile: mapping.yaml
+TemplatesRoot: templates
+TemplatesType: go/template
+StaticRoot: static
+OutputRoot: output
+`,
+		"content/site.yaml": `
+pages:
+  - name: a
+  - name: b
+`,
+		"content/mapping.yaml": `
+- PerMatchOutput: jq:.name + ".html"
+  Template: page.html
+  Selector: jq:.pages[]
+`,
+		"templates/page.html": `page {{.name}}`,
+		"static/css/site.css": `body {}`,
+	})
+
+	sink := processor.NewMemorySink()
+	buildSiteFS(t, siteFS, nil, func(string) (processor.OutputSink, error) {
+		return sink, nil
+	})
+
+	require.Equal(t, map[string][]byte{
+		"a.html":              []byte("page a"),
+		"b.html":              []byte("page b"),
+		"static/css/site.css": []byte("body {}"),
+	}, sink.Files)
+}
+
+func TestNewOutputSink(t *testing.T) {
+	require.IsType(t, &processor.DirSink{}, processor.NewOutputSink("output"))
+	require.IsType(t, &processor.ZipSink{}, processor.NewOutputSink("site.zip"))
+	require.IsType(t, &processor.TarGzSink{}, processor.NewOutputSink("out/site.tar.gz"))
+	require.IsType(t, &processor.TarGzSink{}, processor.NewOutputSink("site.TGZ"))
+}
+
+func TestArchiveSinks(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"index.html":          "home",
+		"static/css/site.css": "body {}",
+	}
+
+	writeAll := func(sink processor.OutputSink) {
+		require.NoError(t, sink.Clear())
+		require.NoError(t, sink.WriteFile("stale.html", []byte("cleared")))
+		require.NoError(t, sink.Clear())
+		for relPath, contents := range files {
+			require.NoError(t, sink.WriteFile(relPath, []byte(contents)))
+		}
+		require.NoError(t, sink.Close())
+	}
+
+	zipPath := filepath.Join(dir, "out", "site.zip")
+	writeAll(processor.NewOutputSink(zipPath))
+	zipReader, err := zip.OpenReader(zipPath)
+	require.NoError(t, err)
+	defer zipReader.Close()
+	zipFiles := map[string]string{}
+	for _, f := range zipReader.File {
+		r, err := f.Open()
+		require.NoError(t, err)
+		contents, err := io.ReadAll(r)
+		require.NoError(t, err)
+		zipFiles[f.Name] = string(contents)
+	}
+	require.Equal(t, files, zipFiles)
+
+	tarPath := filepath.Join(dir, "site.tar.gz")
+	writeAll(processor.NewOutputSink(tarPath))
+	f, err := os.Open(tarPath)
+	require.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	tarReader := tar.NewReader(gz)
+	tarFiles := map[string]string{}
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		contents, err := io.ReadAll(tarReader)
+		require.NoError(t, err)
+		tarFiles[header.Name] = string(contents)
+	}
+	require.Equal(t, files, tarFiles)
+}
@@ -0,0 +1,64 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const envVarPrefix = "INCANT_"
+
+// OverlayPath returns the path of the environment-specific overlay for a
+// file, e.g. config.hjson -> config.production.hjson.
+func OverlayPath(basePath string, env string) string {
+	noExt, ext := TrimExt(basePath)
+	return fmt.Sprintf("%s.%s%s", noExt, env, ext)
+}
+
+// loadOptionalFile decodes filePath into output, on top of whatever output
+// already contains. A missing file is not an error.
+func loadOptionalFile(loader FileLoader, filePath string, output any) (bool, error) {
+	err := loader.LoadFile(filePath, output)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ApplyEnvOverrides sets Config fields from INCANT_<FIELD> environment
+// variables, where <FIELD> is the upper-cased field name. For example,
+// INCANT_OUTPUTROOT overrides OutputRoot.
+func ApplyEnvOverrides(config *Config, lookupEnvFn func(string) (string, bool)) error {
+	configValue := reflect.ValueOf(config).Elem()
+	configType := configValue.Type()
+	for i := 0; i < configType.NumField(); i++ {
+		field := configType.Field(i)
+		envName := envVarPrefix + strings.ToUpper(field.Name)
+		envValue, hasValue := lookupEnvFn(envName)
+		if !hasValue {
+			continue
+		}
+
+		fieldValue := configValue.Field(i)
+		switch fieldValue.Kind() {
+		case reflect.String:
+			fieldValue.SetString(envValue)
+		case reflect.Bool:
+			boolValue, err := strconv.ParseBool(envValue)
+			if err != nil {
+				return fmt.Errorf("%s must be a boolean: %s", envName, err.Error())
+			}
+			fieldValue.SetBool(boolValue)
+		default:
+			return fmt.Errorf("%s cannot be set from the environment", envName)
+		}
+		Printfln("Applied %s from the environment", envName)
+	}
+	return nil
+}
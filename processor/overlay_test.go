@@ -0,0 +1,34 @@
+package processor_test
+
+import (
+	"testing"
+
+	"github.com/treaster/incant/processor"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOverlayPath(t *testing.T) {
+	require.Equal(t, "example/config.production.hjson", processor.OverlayPath("example/config.hjson", "production"))
+	require.Equal(t, "site_data.staging.yaml", processor.OverlayPath("site_data.yaml", "staging"))
+}
+
+func TestApplyEnvOverrides(t *testing.T) {
+	env := map[string]string{
+		"INCANT_OUTPUTROOT": "./output-prod",
+		"INCANT_UNRELATED":  "ignored",
+	}
+	lookupEnv := func(name string) (string, bool) {
+		value, hasValue := env[name]
+		return value, hasValue
+	}
+
+	config := processor.Config{
+		ContentRoot: "content/",
+		OutputRoot:  "./output",
+	}
+	err := processor.ApplyEnvOverrides(&config, lookupEnv)
+	require.NoError(t, err)
+	require.Equal(t, "content/", config.ContentRoot)
+	require.Equal(t, "./output-prod", config.OutputRoot)
+}
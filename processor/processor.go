@@ -2,114 +2,347 @@ package processor
 
 import (
 	"bytes"
-	"os"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"time"
 )
 
 type processor struct {
-	siteRoot        string
+	// ctx is checked between outputs, to stop a cancelled build.
+	ctx             context.Context
+	diags           *diagnostics
+	output          OutputSink
+	env             string
 	config          Config
 	contentLoader   FileLoader
 	templatesLoader FileLoader
 	mappingLoader   FileLoader
-	staticLoader    FileLoader
-	templateMgr     TemplateMgr
+	static          []staticMount
+	templates       *templateEngines
+	themes          []loadedTheme
+	types           map[string]reflect.Type
+	translator      *translator
+	// languageLoaders holds the content loader of each language with its own
+	// ContentRoot, and languageContents and languageMappings what each
+	// language's content and mappings load as, if they differ from the site's.
+	languageLoaders  map[string]FileLoader
+	languageContents map[string]any
+	languageMappings map[string][]MappingForTemplate
+	// outputPrefix is the OutputPrefix of the language being built.
+	outputPrefix string
 }
 
-func Load(
-	readFileFn func(string) ([]byte, error),
-	configPath string,
-	templateMgrFactories map[string]func(string) TemplateMgr,
-) (Processor, bool) {
+// Load reads the site configured by opts, for programs which run the phases
+// of a build themselves, rather than with Build. It applies the same defaults
+// as Build, but doesn't run Hooks. Output is discarded unless opts.NewSink is
+// set.
+func Load(ctx context.Context, opts BuildOptions) (Processor, bool) {
+	p, hasError := load(ctx, &diagnostics{}, opts)
+	if hasError {
+		return nil, true
+	}
+	return p, false
+}
+
+func load(ctx context.Context, diags *diagnostics, opts BuildOptions) (*processor, bool) {
+	templateMgrFactories := opts.TemplateMgrFactories
+	if templateMgrFactories == nil {
+		templateMgrFactories = DefaultTemplateMgrFactories()
+	}
+	decoders := opts.Decoders
+	if decoders == nil {
+		decoders = DefaultDecoders()
+	}
+	lookupEnvFn := opts.LookupEnv
+	if lookupEnvFn == nil {
+		lookupEnvFn = func(string) (string, bool) { return "", false }
+	}
+	newSink := opts.NewSink
+	if newSink == nil {
+		newSink = func(string) (OutputSink, error) {
+			return NewMemorySink(), nil
+		}
+	}
+	siteFS := opts.SiteFS
+	configPath := opts.ConfigPath
+	env := opts.Env
 
 	Printfln("\nLOADING CONFIG FILE...")
 
 	if configPath == "" {
-		return nil, Errorfln("--config must be defined")
+		return nil, diags.errorfln("--config must be defined")
 	}
 
-	configLoader := MakeFileLoader(".", ".", readFileFn)
+	configLoader := MakeFileLoader(siteFS, ".", decoders)
 
 	var config Config
 	err := configLoader.LoadFile(configPath, &config)
 	if err != nil {
-		return nil, Errorfln("error decoding config file: %s", err.Error())
+		return nil, diags.errorfln("error decoding config file: %s", err.Error())
+	}
+
+	if env != "" {
+		overlayPath := OverlayPath(configPath, env)
+		isLoaded, err := loadOptionalFile(configLoader, overlayPath, &config)
+		if err != nil {
+			return nil, diags.errorfln("error decoding config overlay file %s: %s", overlayPath, err.Error())
+		}
+		if isLoaded {
+			Printfln("Applied config overlay %s", overlayPath)
+		}
+	}
+
+	err = ApplyEnvOverrides(&config, lookupEnvFn)
+	if err != nil {
+		return nil, diags.errorfln("error applying environment overrides: %s", err.Error())
+	}
+
+	if opts.OverrideConfig != nil {
+		opts.OverrideConfig(&config)
 	}
 
 	// Clean the config
-	config.StaticRoot = filepath.Clean(config.StaticRoot)
-	config.OutputRoot = filepath.Clean(config.OutputRoot) + "/"
+	config.StaticRoot = path.Clean(filepath.ToSlash(config.StaticRoot))
+	config.OutputRoot = filepath.Clean(config.OutputRoot)
+	if config.DraftField == "" {
+		config.DraftField = defaultDraftField
+	}
+	if config.PublishDateField == "" {
+		config.PublishDateField = defaultPublishDateField
+	}
+	if config.ExpiryDateField == "" {
+		config.ExpiryDateField = defaultExpiryDateField
+	}
+	if config.HighlightClasses && config.HighlightStylesheet == "" {
+		config.HighlightStylesheet = defaultHighlightStylesheet
+	}
+
+	err = checkSitePaths(config)
+	if err != nil {
+		return nil, diags.errorfln("%s", err.Error())
+	}
 
 	if config.MappingFile == "" {
-		Errorfln("MappingFile must not be empty.")
+		diags.errorfln("MappingFile must not be empty.")
 		return nil, true
 	}
 
-	siteRoot := filepath.Dir(configPath) + "/"
+	siteRoot := path.Dir(configPath)
 
 	if config.TemplatesType == "" {
-		Errorfln("TemplatesType must not be empty.")
-		return nil, true
-	}
-	templateMgrFactory, hasType := templateMgrFactories[config.TemplatesType]
-	if !hasType {
-		Errorfln("Unrecognized TemplatesType %q.", config.TemplatesType)
+		diags.errorfln("TemplatesType must not be empty.")
 		return nil, true
 	}
 
 	// TODO(treaster): Consider if data URLs should pull assets relative to
 	// siteRoot, or contentRoot? SiteRoot for now I guess.
-	templateMgr := templateMgrFactory(siteRoot)
+	highlight := HighlightOptions{
+		config.HighlightStyle,
+		config.HighlightLineNumbers,
+		config.HighlightClasses,
+	}
+	if config.HighlightStyle != "" {
+		_, err := HighlightStylesheet(config.HighlightStyle)
+		if err != nil {
+			return nil, diags.errorfln("error in HighlightStyle: %s", err.Error())
+		}
+	}
+	outputPrefixes := map[string]bool{}
+	for i, language := range config.Languages {
+		if language.Code == "" {
+			return nil, diags.errorfln("Languages[%d] must have a Code", i)
+		}
+		if outputPrefixes[filepath.Clean(language.OutputPrefix)] {
+			return nil, diags.errorfln("Languages[%d] has the same OutputPrefix as another language", i)
+		}
+		outputPrefixes[filepath.Clean(language.OutputPrefix)] = true
+	}
+	translator := newTranslator(config.Languages)
+
+	shortcodes := &shortcodeRenderer{nil, newMarkdown(highlight, true), newMarkdown(highlight, false), config.AutoEscape}
+	siteDirFS, err := fs.Sub(siteFS, siteRoot)
+	if err != nil {
+		return nil, diags.errorfln("error opening site directory: %s", err.Error())
+	}
+
+	output, err := newSink(config.OutputRoot)
+	if err != nil {
+		return nil, diags.errorfln("error opening output: %s", err.Error())
+	}
 
-	contentLoader := MakeFileLoader(
-		siteRoot,
-		config.ContentRoot,
-		readFileFn,
+	funcs := StdTemplateFuncs(siteDirFS)
+	funcs["RenderMarkdown"] = shortcodes.RenderMarkdown
+	for name, fn := range translator.funcs() {
+		funcs[name] = fn
+	}
+	for name, fn := range opts.Funcs {
+		if fn == nil || reflect.TypeOf(fn).Kind() != reflect.Func {
+			return nil, diags.errorfln("custom template function %q is a %T, not a function", name, fn)
+		}
+		funcs[name] = fn
+	}
+
+	templates, err := makeTemplateEngines(
+		templateMgrFactories,
+		TemplateMgrOptions{
+			DataFS:     siteDirFS,
+			AutoEscape: config.AutoEscape,
+			Funcs:      funcs,
+		},
+		config.TemplatesType,
+		config.TemplatesTypeByExtension,
 	)
+	if err != nil {
+		return nil, diags.errorfln("error setting up template engines: %s", err.Error())
+	}
+	shortcodes.templates = templates
+
+	ignore, err := NewIgnoreMatcher(config.Ignore)
+	if err != nil {
+		return nil, diags.errorfln("error in Ignore: %s", err.Error())
+	}
+
+	themes, err := loadThemes(config.Themes, siteDirFS, opts.Themes, decoders)
+	if err != nil {
+		return nil, diags.errorfln("error loading themes: %s", err.Error())
+	}
 
-	templatesLoader := MakeFileLoader(
-		siteRoot,
+	var execRunner *ExecRunner
+	if len(config.ExecAllow) > 0 {
+		if opts.ExecDir == "" {
+			return nil, diags.errorfln("ExecAllow is set, but the site directory on disk is unknown, so commands can't be run")
+		}
+		cacheDir := ""
+		if config.ExecCacheDir != "" {
+			cacheDir = filepath.Join(opts.ExecDir, config.ExecCacheDir)
+		}
+		execRunner = NewExecRunner(ctx, opts.ExecDir, config.ExecAllow, cacheDir)
+	}
+	makeContentLoader := func(root string, beneath []fs.FS) FileLoader {
+		loader := layeredLoader(siteDirFS, root, beneath, decoders).WithIgnore(ignore)
+		if execRunner != nil {
+			loader = loader.WithExec(execRunner)
+		}
+		return loader
+	}
+
+	themeContentRoots := themeLayers(themes, func(t Theme) string { return t.ContentRoot })
+	contentLoader := makeContentLoader(config.ContentRoot, themeContentRoots)
+
+	// A language's ContentRoot is layered above the site's.
+	languageLoaders := map[string]FileLoader{}
+	for _, language := range config.Languages {
+		if language.ContentRoot != "" {
+			beneath := append([]fs.FS{subFS(siteDirFS, config.ContentRoot)}, themeContentRoots...)
+			languageLoaders[language.Code] = makeContentLoader(language.ContentRoot, beneath)
+		}
+	}
+
+	templatesLoader := layeredLoader(
+		siteDirFS,
 		config.TemplatesRoot,
-		readFileFn,
-	)
+		themeLayers(themes, func(t Theme) string { return t.TemplatesRoot }),
+		decoders,
+	).WithIgnore(ignore)
 
-	staticLoader := MakeFileLoader(
-		siteRoot,
-		config.StaticRoot,
-		readFileFn,
-	)
+	static, err := makeStaticMounts(config, siteDirFS, themeLayers(themes, func(t Theme) string { return t.StaticRoot }))
+	if err != nil {
+		return nil, diags.errorfln("%s", err.Error())
+	}
 
-	return &processor{
-		siteRoot,
+	p := &processor{
+		ctx,
+		diags,
+		output,
+		env,
 		config,
 		contentLoader,
 		templatesLoader,
 		contentLoader, // contentLoader also works as mappingLoader
-		staticLoader,
-		templateMgr,
-	}, false
+		static,
+		templates,
+		themes,
+		map[string]reflect.Type{},
+		translator,
+		languageLoaders,
+		map[string]any{},
+		map[string][]MappingForTemplate{},
+		"",
+	}
+
+	// Types are registered in a stable order, so that errors are too.
+	names := make([]string, 0, len(opts.Types))
+	for name := range opts.Types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	hasError := false
+	for _, name := range names {
+		err := p.RegisterType(name, opts.Types[name])
+		if err != nil {
+			hasError = diags.errorfln("error registering type %q: %s", name, err.Error())
+		}
+	}
+	return p, hasError
+}
+
+// checkSitePaths returns an error if a directory of the config is outside the
+// site directory. Site files are read through SiteFS, which can't reach
+// beyond it.
+func checkSitePaths(config Config) error {
+	type sitePath struct {
+		name string
+		dir  string
+	}
+	paths := []sitePath{
+		{"ContentRoot", config.ContentRoot},
+		{"TemplatesRoot", config.TemplatesRoot},
+		{"StaticRoot", config.StaticRoot},
+	}
+	for i, mount := range config.Static {
+		paths = append(paths, sitePath{fmt.Sprintf("Static[%d] Source", i), mount.Source})
+	}
+	for i, language := range config.Languages {
+		paths = append(paths, sitePath{fmt.Sprintf("Languages[%d] ContentRoot", i), language.ContentRoot})
+	}
+
+	for _, sitePath := range paths {
+		if filepath.IsAbs(sitePath.dir) || !fs.ValidPath(path.Clean(filepath.ToSlash(sitePath.dir))) {
+			return fmt.Errorf("%s %q must be a relative path within the directory of the config file", sitePath.name, sitePath.dir)
+		}
+	}
+	return nil
 }
 
 func (p *processor) LoadTemplates() bool {
 	Printfln("\nLOADING TEMPLATES...")
 
-	templateNames := p.templatesLoader.FindFiles()
+	templateNames, err := p.templatesLoader.FindFiles()
+	if err != nil {
+		return p.diags.errorfln("error listing templates: %s", err.Error())
+	}
 	if len(templateNames) == 0 {
-		return Errorfln("no templates found in templates root %q", p.templatesLoader.BaseDir())
+		return p.diags.errorfln("no templates found in templates root %q", p.templatesLoader.BaseDir())
 	}
 
 	hasError := false
 	for _, templateName := range templateNames {
 		tmplContents, err := p.templatesLoader.LoadFileAsBytes(templateName)
 		if err != nil {
-			newError := Errorfln("error reading template %q: %s", templateName, err.Error())
+			newError := p.diags.errorfln("error reading template %q: %s", templateName, err.Error())
 			hasError = hasError || newError
 			continue
 		}
 
-		err = p.templateMgr.ParseOne(templateName, tmplContents)
+		err = p.templates.ParseOne(templateName, tmplContents)
 		if err != nil {
-			newError := Errorfln("error parsing template %q: %s", templateName, err.Error())
+			newError := p.diags.errorfln("error parsing template %q: %s", templateName, err.Error())
 			hasError = hasError || newError
 		}
 	}
@@ -126,28 +359,180 @@ func (p *processor) LoadTemplates() bool {
 func (p *processor) LoadSiteContent() (any, bool) {
 	Printfln("\nLOADING SITE CONTENT...")
 
-	hasError := false
-	siteContent, errors := EvalContentFile(p.contentLoader, p.config.SiteContentFile)
-	if len(errors) > 0 {
-		return nil, false
+	siteContent, hasError := p.evalSiteContent(p.contentLoader)
+	if hasError {
+		return nil, true
+	}
+
+	for _, language := range p.config.Languages {
+		loader := p.languageLoader(language)
+		content := siteContent
+		if language.ContentRoot != "" {
+			content, hasError = p.evalSiteContent(loader)
+			if hasError {
+				return nil, true
+			}
+		}
+		if language.SiteContentFile != "" {
+			overlay, errs := EvalContentFile(loader, language.SiteContentFile)
+			if len(errs) > 0 {
+				return nil, p.diags.addErrors(errs)
+			}
+			content = mergeValues(content, overlay, "", mergeStrategies{defaultStrategy: mergeReplace})
+		}
+		if language.ContentRoot != "" || language.SiteContentFile != "" {
+			p.languageContents[language.Code] = content
+		}
+
+		if language.TranslationsFile != "" {
+			var translations map[string]any
+			err := loader.LoadFile(language.TranslationsFile, &translations)
+			if err != nil {
+				return nil, p.diags.errorfln("error loading translations %s: %s", language.TranslationsFile, err.Error())
+			}
+			p.translator.translations[language.Code] = translations
+		}
+	}
+
+	if p.config.SiteContentSchema != "" {
+		schema, err := LoadSchema(p.contentLoader, p.config.SiteContentSchema)
+		if err != nil {
+			return nil, p.diags.errorfln("error loading site content schema %s: %s", p.config.SiteContentSchema, err.Error())
+		}
+
+		stack := []string{fmt.Sprintf("file:%s", p.config.SiteContentFile)}
+		for _, err := range schema.Validate(siteContent, stack) {
+			hasError = p.diags.errorfln("site content does not match schema %s: %s", p.config.SiteContentSchema, err.Error())
+		}
+		for _, language := range p.config.Languages {
+			content, hasContent := p.languageContents[language.Code]
+			if !hasContent {
+				continue
+			}
+			for _, err := range schema.Validate(content, stack) {
+				hasError = p.diags.errorfln("site content for language %s does not match schema %s: %s", language.Code, p.config.SiteContentSchema, err.Error())
+			}
+		}
+		if hasError {
+			return nil, true
+		}
+	}
+
+	for _, theme := range p.themes {
+		if theme.manifest.ContentSchema == "" {
+			continue
+		}
+		themeLoader := MakeFileLoader(theme.root(theme.manifest.ContentRoot), ".", p.contentLoader.decoders)
+		schema, err := LoadSchema(themeLoader, theme.manifest.ContentSchema)
+		if err != nil {
+			return nil, p.diags.errorfln("error loading content schema %s of theme %q: %s", theme.manifest.ContentSchema, theme.name, err.Error())
+		}
+
+		stack := []string{fmt.Sprintf("file:%s", p.config.SiteContentFile)}
+		for _, err := range schema.Validate(siteContent, stack) {
+			hasError = p.diags.errorfln("site content does not match the content schema of theme %q: %s", theme.name, err.Error())
+		}
+		for _, language := range p.config.Languages {
+			content, hasContent := p.languageContents[language.Code]
+			if !hasContent {
+				continue
+			}
+			for _, err := range schema.Validate(content, stack) {
+				hasError = p.diags.errorfln("site content for language %s does not match the content schema of theme %q: %s", language.Code, theme.name, err.Error())
+			}
+		}
+	}
+	if hasError {
+		return nil, true
 	}
 
 	return siteContent, hasError
 }
 
+// evalSiteContent evaluates the site content file with a content loader, and
+// merges the overlay for the build's environment on top of it.
+func (p *processor) evalSiteContent(loader FileLoader) (any, bool) {
+	siteContent, errs := EvalContentFile(loader, p.config.SiteContentFile)
+	if len(errs) > 0 {
+		return nil, p.diags.addErrors(errs)
+	}
+
+	if p.env != "" {
+		overlayPath := OverlayPath(p.config.SiteContentFile, p.env)
+		_, err := loader.LoadFileAsBytes(overlayPath)
+		if err == nil {
+			overlay, errs := EvalContentFile(loader, overlayPath)
+			if len(errs) > 0 {
+				return nil, p.diags.addErrors(errs)
+			}
+			Printfln("Applied site content overlay %s", overlayPath)
+			siteContent = mergeValues(siteContent, overlay, "", mergeStrategies{defaultStrategy: mergeReplace})
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, p.diags.errorfln("error reading site content overlay %s: %s", overlayPath, err.Error())
+		}
+	}
+	return siteContent, false
+}
+
+// languageLoader returns the content loader for a language, which is the
+// site's unless the language has its own ContentRoot.
+func (p *processor) languageLoader(language Language) FileLoader {
+	loader, hasLoader := p.languageLoaders[language.Code]
+	if !hasLoader {
+		return p.contentLoader
+	}
+	return loader
+}
+
+// languageContent returns the site content for a language.
+func (p *processor) languageContent(language Language, siteContent any) any {
+	content, hasContent := p.languageContents[language.Code]
+	if !hasContent {
+		return siteContent
+	}
+	return content
+}
+
+// languageMappingsFor returns the mappings for a language.
+func (p *processor) languageMappingsFor(language Language, allMappings []MappingForTemplate) []MappingForTemplate {
+	mappings, hasMappings := p.languageMappings[language.Code]
+	if !hasMappings {
+		return allMappings
+	}
+	return mappings
+}
+
 func (p *processor) LoadMappings() ([]MappingForTemplate, bool) {
 	Printfln("\nLOADING MAPPING FILES...")
 
+	allMappings, hasError := p.loadMappings(p.mappingLoader)
+	for _, language := range p.config.Languages {
+		loader, hasLoader := p.languageLoaders[language.Code]
+		if !hasLoader {
+			continue
+		}
+		Printfln("  language %s", language.Code)
+		mappings, newError := p.loadMappings(loader)
+		hasError = hasError || newError
+		p.languageMappings[language.Code] = mappings
+	}
+	return allMappings, hasError
+}
+
+func (p *processor) loadMappings(mappingLoader FileLoader) ([]MappingForTemplate, bool) {
 	hasError := false
-	mappingPaths := p.mappingLoader.FindFilesWithName(p.config.MappingFile)
+	mappingPaths, err := mappingLoader.FindFilesWithName(p.config.MappingFile)
+	if err != nil {
+		return nil, p.diags.errorfln("error finding mapping files: %s", err.Error())
+	}
 
 	var allMappings []MappingForTemplate
 	for _, mappingPath := range mappingPaths {
 		Printfln("  mapping path %s", mappingPath)
 		var rawMappings []RawMapping
-		err := p.mappingLoader.LoadFile(mappingPath, &rawMappings)
+		err := mappingLoader.LoadFile(mappingPath, &rawMappings)
 		if err != nil {
-			hasError = Errorfln("error loading mapping file %s: %s", mappingPath, err.Error())
+			hasError = p.diags.errorfln("error loading mapping file %s: %s", mappingPath, err.Error())
 			continue
 		}
 
@@ -156,19 +541,62 @@ func (p *processor) LoadMappings() ([]MappingForTemplate, bool) {
 		for i, rawMapping := range rawMappings {
 			Printfln("    found mapping for types %+v onto template %q", rawMapping.Selector, rawMapping.Template)
 
-			AssertNonEmpty(rawMapping.Template)
-
-			if (rawMapping.SingleOutput == "" && rawMapping.PerMatchOutput == "") ||
-				(rawMapping.SingleOutput != "" && rawMapping.PerMatchOutput != "") {
-				hasError = Errorfln("exactly one of single_output or per_match_output must be set on mapping %s %i", mappingPath, i)
+			numModes := 0
+			for _, modeField := range []string{rawMapping.SingleOutput, rawMapping.PerMatchOutput, rawMapping.Aliases} {
+				if modeField != "" {
+					numModes++
+				}
+			}
+			if numModes != 1 {
+				hasError = p.diags.errorfln("exactly one of SingleOutput, PerMatchOutput or Aliases must be set on mapping %s %d", mappingPath, i)
 				continue
 			}
 
+			if rawMapping.Aliases != "" {
+				if rawMapping.RedirectTo == "" {
+					hasError = p.diags.errorfln("RedirectTo must be set when Aliases is set on mapping %s %d", mappingPath, i)
+					continue
+				}
+			} else {
+				AssertNonEmpty(rawMapping.Template)
+			}
+
+			var schema *Schema
+			if rawMapping.Schema != "" {
+				schema, err = LoadSchema(p.mappingLoader, rawMapping.Schema)
+				if err != nil {
+					hasError = p.diags.errorfln("error loading schema %s for mapping %s %d: %s", rawMapping.Schema, mappingPath, i, err.Error())
+					continue
+				}
+			}
+
+			if rawMapping.TemplatesType != "" {
+				err := p.templates.Override(rawMapping.Template, rawMapping.TemplatesType)
+				if err != nil {
+					hasError = p.diags.errorfln("error on mapping %s %d: %s", mappingPath, i, err.Error())
+					continue
+				}
+			}
+
+			if rawMapping.Type != "" {
+				_, isRegistered := p.types[rawMapping.Type]
+				if !isRegistered {
+					hasError = p.diags.errorfln("unregistered Type %q on mapping %s %d", rawMapping.Type, mappingPath, i)
+					continue
+				}
+			}
+
 			forTemplate := MappingForTemplate{
 				rawMapping.SingleOutput,
 				rawMapping.PerMatchOutput,
 				rawMapping.Template,
 				rawMapping.Selector,
+				schema,
+				rawMapping.Type,
+				rawMapping.Aliases,
+				rawMapping.RedirectTo,
+				rawMapping.RedirectsFile,
+				rawMapping.NginxMapFile,
 			}
 			allMappings = append(allMappings, forTemplate)
 		}
@@ -180,10 +608,19 @@ func (p *processor) LoadMappings() ([]MappingForTemplate, bool) {
 func (p *processor) ClearExistingOutput() bool {
 	Printfln("\nCLEARING EXISTING OUTPUT...")
 
-	outputPath := filepath.Join(p.siteRoot, p.config.OutputRoot)
-	err := os.RemoveAll(outputPath)
+	err := p.output.Clear()
 	if err != nil {
-		return Errorfln("error deleting existing output: %s", err.Error())
+		return p.diags.errorfln("error deleting existing output: %s", err.Error())
+	}
+	return false
+}
+
+func (p *processor) CloseOutput() bool {
+	Printfln("\nFINISHING OUTPUT...")
+
+	err := p.output.Close()
+	if err != nil {
+		return p.diags.errorfln("error finishing output: %s", err.Error())
 	}
 	return false
 }
@@ -192,34 +629,81 @@ func (p *processor) ProcessContent(allMappings []MappingForTemplate, siteContent
 	Printfln("\nEXECUTING CONTENT + TEMPLATES...")
 
 	hasError := false
-	for _, mapping := range allMappings {
-		Printfln("    processOneMapping")
-		newError := p.processOneMapping(mapping, siteContent)
+	if len(p.config.Languages) == 0 {
+		for _, mapping := range allMappings {
+			if p.ctx.Err() != nil {
+				return true
+			}
+			Printfln("    processOneMapping")
+			newError := p.processOneMapping(mapping, siteContent)
+			hasError = hasError || newError
+		}
+	}
+
+	for _, language := range p.config.Languages {
+		Printfln("  language %s", language.Code)
+		p.translator.current = language
+		p.outputPrefix = language.OutputPrefix
+
+		languageContent := p.languageContent(language, siteContent)
+		for _, mapping := range p.languageMappingsFor(language, allMappings) {
+			if p.ctx.Err() != nil {
+				return true
+			}
+			Printfln("    processOneMapping")
+			newError := p.processOneMapping(mapping, languageContent)
+			hasError = hasError || newError
+		}
+	}
+	p.translator.current = Language{}
+	p.outputPrefix = ""
+
+	if p.config.HighlightStyle != "" && p.config.HighlightClasses {
+		stylesheet, err := HighlightStylesheet(p.config.HighlightStyle)
+		if err != nil {
+			return p.diags.errorfln("error generating highlight stylesheet: %s", err.Error())
+		}
+		newError := p.writeOutput(p.config.HighlightStylesheet, []byte(stylesheet))
 		hasError = hasError || newError
 	}
 	return hasError
 }
 
 func (p *processor) processOneMapping(mapping MappingForTemplate, siteContent any) bool {
+	if mapping.Aliases != "" {
+		return p.processRedirectMapping(mapping, siteContent)
+	}
+
 	templateName := mapping.Template
 	if templateName == "" {
-		Errorfln("mapping file must contain key 'config.template', which defines which template file should be used.")
+		p.diags.errorfln("mapping file must contain key 'config.template', which defines which template file should be used.")
 		return true
 	}
 
-	itemMatches := EvalContentExpr(mapping.Selector, siteContent)
-	Printfln("SELECTOR %q found %d matches", mapping.Selector, len(itemMatches))
-
-	hasError := false
+	// Matches which fail the schema aren't rendered, since templates and
+	// output names may rely on what the schema requires.
+	itemMatches, hasError := p.selectMatches(mapping, siteContent)
+	if hasError {
+		return true
+	}
+	typedMatches, hasError := p.decodeMatches(mapping, itemMatches)
+	if hasError {
+		return true
+	}
 
 	if mapping.SingleOutput != "" {
-		newError := p.executeOneTemplate(templateName, itemMatches, mapping.SingleOutput)
+		newError := p.executeOneTemplate(templateName, p.typedList(mapping, typedMatches), mapping.SingleOutput)
 		hasError = hasError || newError
 	}
 	if mapping.PerMatchOutput != "" {
-		for _, item := range itemMatches {
+		for i, item := range itemMatches {
+			if p.ctx.Err() != nil {
+				return true
+			}
+			// Output names are always evaluated against the untyped match, since
+			// they are expressions over the content.
 			itemName := EvalOutputBase(mapping.PerMatchOutput, item)
-			newError := p.executeOneTemplate(templateName, item, itemName)
+			newError := p.executeOneTemplate(templateName, typedMatches[i], itemName)
 			hasError = hasError || newError
 		}
 	}
@@ -227,26 +711,57 @@ func (p *processor) processOneMapping(mapping MappingForTemplate, siteContent an
 	return hasError
 }
 
+// selectMatches evaluates a mapping selector, drops any matches which
+// shouldn't be published in this build, and validates the remainder against
+// the mapping schema.
+func (p *processor) selectMatches(mapping MappingForTemplate, siteContent any) ([]any, bool) {
+	selector := mapping.Selector
+	itemMatches := EvalContentExpr(selector, siteContent)
+
+	publishedMatches, errs := FilterPublished(itemMatches, publishRulesFromConfig(p.config), time.Now())
+	hasError := false
+	for _, err := range errs {
+		hasError = p.diags.errorfln("error filtering matches of selector %q: %s", selector, err.Error())
+	}
+
+	Printfln("SELECTOR %q found %d matches, %d published", selector, len(itemMatches), len(publishedMatches))
+
+	if mapping.Schema != nil {
+		for i, match := range publishedMatches {
+			stack := []string{fmt.Sprintf("selector:%s", selector), fmt.Sprintf("[%d]", i)}
+			for _, err := range mapping.Schema.Validate(match, stack) {
+				hasError = p.diags.errorfln("selector match does not match schema: %s", err.Error())
+			}
+		}
+	}
+
+	return publishedMatches, hasError
+}
+
 func (p *processor) executeOneTemplate(tmplName string, tmplData any, outputRelPath string) bool {
 	Printfln("Execute template %s", tmplName)
 
+	p.translator.pagePath = outputRelPath
+
 	var output bytes.Buffer
-	err := p.templateMgr.Execute(tmplName, tmplData, &output)
+	err := p.templates.Execute(tmplName, tmplData, &output)
 	if err != nil {
-		return Errorfln("error executing template: %s", err.Error())
+		return p.diags.errorfln("error executing template: %s", err.Error())
 	}
 
-	outputPath := filepath.Join(p.siteRoot, p.config.OutputRoot, outputRelPath)
-	outputDir := filepath.Dir(outputPath)
-	err = os.MkdirAll(outputDir, 0755)
+	return p.writeOutput(outputRelPath, output.Bytes())
+}
+
+func (p *processor) writeOutput(outputRelPath string, contents []byte) bool {
+	outputPath, err := cleanOutputPath(path.Join(p.outputPrefix, outputRelPath))
 	if err != nil {
-		return Errorfln("error creating output directory: %s", err.Error())
+		return p.diags.errorfln("error writing output file: %s", err.Error())
 	}
 
 	Printfln("    Writing file %s", outputPath)
-	err = os.WriteFile(outputPath, output.Bytes(), 0644)
+	err = p.output.WriteFile(outputPath, contents)
 	if err != nil {
-		return Errorfln("error writing output file: %s", err.Error())
+		return p.diags.errorfln("error writing output file: %s", err.Error())
 	}
 
 	return false
@@ -257,23 +772,47 @@ func (p *processor) CopyStatic() bool {
 
 	hasError := false
 
-	staticFiles := p.staticLoader.FindFiles()
-	Printfln("copying %d static files", len(staticFiles))
-	for _, staticFile := range staticFiles {
-		outPath := filepath.Join(p.siteRoot, p.config.OutputRoot, p.config.StaticRoot, staticFile)
-		outDir := filepath.Dir(outPath)
-		err := os.MkdirAll(outDir, 0755)
+	// Later mounts replace files from earlier ones, so every mount is listed
+	// before anything is copied.
+	type staticFile struct {
+		mount staticMount
+		path  string
+	}
+	sources := map[string]staticFile{}
+	var outPaths []string
+	for _, mount := range p.static {
+		files, err := mount.loader.FindFiles()
+		if err != nil {
+			return p.diags.errorfln("error listing static files: %s", err.Error())
+		}
+		for _, file := range files {
+			if !mount.isIncluded(file) {
+				continue
+			}
+			outPath := path.Join(mount.target, file)
+			if _, isListed := sources[outPath]; !isListed {
+				outPaths = append(outPaths, outPath)
+			}
+			sources[outPath] = staticFile{mount, file}
+		}
+	}
+
+	Printfln("copying %d static files", len(outPaths))
+	for _, outPath := range outPaths {
+		if p.ctx.Err() != nil {
+			return true
+		}
+		source := sources[outPath]
+		contents, err := source.mount.loader.LoadFileAsBytes(source.path)
 		if err != nil {
-			Printfln("error making dir for static files: %s", outDir, err.Error())
-			hasError = true
+			hasError = p.diags.errorfln("error reading static file %s: %s", source.path, err.Error())
 			continue
 		}
 
-		Printfln("    copy %s to %s", staticFile, outPath)
-		err = p.staticLoader.Copy(staticFile, outPath)
+		Printfln("    copy %s to %s", path.Join(source.mount.loader.BaseDir(), source.path), outPath)
+		err = p.output.WriteFile(outPath, contents)
 		if err != nil {
-			Printfln("error copying file %s to %s: %s", staticFile, outPath, err.Error())
-			hasError = true
+			hasError = p.diags.errorfln("error copying file %s to %s: %s", source.path, outPath, err.Error())
 			continue
 		}
 	}
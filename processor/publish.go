@@ -0,0 +1,115 @@
+package processor
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	defaultDraftField       = "draft"
+	defaultPublishDateField = "publishDate"
+	defaultExpiryDateField  = "expiryDate"
+)
+
+var publishDateLayouts = []string{
+	time.RFC3339,
+	time.DateTime,
+	time.DateOnly,
+}
+
+type PublishRules struct {
+	DraftField       string
+	PublishDateField string
+	ExpiryDateField  string
+
+	IncludeDrafts bool
+	IncludeFuture bool
+}
+
+func publishRulesFromConfig(config Config) PublishRules {
+	return PublishRules{
+		DraftField:       config.DraftField,
+		PublishDateField: config.PublishDateField,
+		ExpiryDateField:  config.ExpiryDateField,
+		IncludeDrafts:    config.Drafts,
+		IncludeFuture:    config.Future,
+	}
+}
+
+// FilterPublished drops the items which shouldn't be published as of now:
+// drafts, items with a publish date in the future, and items with an expiry
+// date in the past. Items that aren't maps are always kept.
+func FilterPublished(items []any, rules PublishRules, now time.Time) ([]any, []error) {
+	var kept []any
+	var errs []error
+	for i, item := range items {
+		itemMap, isMap := item.(map[string]any)
+		if !isMap {
+			kept = append(kept, item)
+			continue
+		}
+
+		isPublished, err := isItemPublished(itemMap, rules, now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("item %d: %s", i, err.Error()))
+			continue
+		}
+		if isPublished {
+			kept = append(kept, item)
+		}
+	}
+	return kept, errs
+}
+
+func isItemPublished(item map[string]any, rules PublishRules, now time.Time) (bool, error) {
+	if draftValue, hasDraft := item[rules.DraftField]; hasDraft && !rules.IncludeDrafts {
+		isDraft, isBool := draftValue.(bool)
+		if !isBool {
+			return false, fmt.Errorf("%s must be a boolean, got %T", rules.DraftField, draftValue)
+		}
+		if isDraft {
+			return false, nil
+		}
+	}
+
+	if dateValue, hasDate := item[rules.PublishDateField]; hasDate && !rules.IncludeFuture {
+		publishDate, err := parsePublishDate(dateValue)
+		if err != nil {
+			return false, fmt.Errorf("bad %s: %s", rules.PublishDateField, err.Error())
+		}
+		if publishDate.After(now) {
+			return false, nil
+		}
+	}
+
+	if dateValue, hasDate := item[rules.ExpiryDateField]; hasDate {
+		expiryDate, err := parsePublishDate(dateValue)
+		if err != nil {
+			return false, fmt.Errorf("bad %s: %s", rules.ExpiryDateField, err.Error())
+		}
+		if !expiryDate.After(now) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// parsePublishDate accepts both native dates, as decoded by the TOML loader,
+// and strings in any of publishDateLayouts.
+func parsePublishDate(value any) (time.Time, error) {
+	switch typed := value.(type) {
+	case time.Time:
+		return typed, nil
+	case string:
+		for _, layout := range publishDateLayouts {
+			parsed, err := time.Parse(layout, typed)
+			if err == nil {
+				return parsed, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("unrecognized date format %q", typed)
+	default:
+		return time.Time{}, fmt.Errorf("expected a date, got %T", value)
+	}
+}
@@ -0,0 +1,61 @@
+package processor_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/treaster/incant/processor"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterPublished(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	items := []any{
+		map[string]any{"name": "plain"},
+		map[string]any{"name": "draft", "draft": true},
+		map[string]any{"name": "notDraft", "draft": false},
+		map[string]any{"name": "past", "publishDate": "2024-05-01"},
+		map[string]any{"name": "future", "publishDate": "2024-07-01T00:00:00Z"},
+		map[string]any{"name": "nativeFuture", "publishDate": now.Add(time.Hour)},
+		map[string]any{"name": "expired", "expiryDate": "2024-06-01 11:00:00"},
+		map[string]any{"name": "notExpired", "expiryDate": "2025-01-01"},
+		"notAMap",
+	}
+
+	names := func(items []any) []any {
+		var result []any
+		for _, item := range items {
+			itemMap, isMap := item.(map[string]any)
+			if isMap {
+				result = append(result, itemMap["name"])
+			} else {
+				result = append(result, item)
+			}
+		}
+		return result
+	}
+
+	rules := processor.PublishRules{
+		DraftField:       "draft",
+		PublishDateField: "publishDate",
+		ExpiryDateField:  "expiryDate",
+	}
+
+	kept, errs := processor.FilterPublished(items, rules, now)
+	require.Equal(t, 0, len(errs))
+	require.Equal(t, []any{"plain", "notDraft", "past", "notExpired", "notAMap"}, names(kept))
+
+	rules.IncludeDrafts = true
+	rules.IncludeFuture = true
+	kept, errs = processor.FilterPublished(items, rules, now)
+	require.Equal(t, 0, len(errs))
+	require.Equal(t, []any{"plain", "draft", "notDraft", "past", "future", "nativeFuture", "notExpired", "notAMap"}, names(kept))
+
+	// Malformed fields are errors, and the item is dropped.
+	kept, errs = processor.FilterPublished([]any{map[string]any{"publishDate": "yesterday"}}, processor.PublishRules{
+		PublishDateField: "publishDate",
+	}, now)
+	require.Equal(t, 1, len(errs))
+	require.Equal(t, 0, len(kept))
+}
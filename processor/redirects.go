@@ -0,0 +1,190 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"path"
+	"strings"
+	"unicode"
+)
+
+type Redirect struct {
+	From string
+	To   string
+}
+
+func (p *processor) processRedirectMapping(mapping MappingForTemplate, siteContent any) bool {
+	itemMatches, hasError := p.selectMatches(mapping, siteContent)
+	if hasError {
+		return true
+	}
+	typedMatches, hasError := p.decodeMatches(mapping, itemMatches)
+	if hasError {
+		return true
+	}
+
+	var redirects []Redirect
+	for i, item := range itemMatches {
+		aliases := redirectAliases(mapping.Aliases, item)
+		if len(aliases) == 0 {
+			continue
+		}
+		target, err := redirectTarget(mapping.RedirectTo, item)
+		if err != nil {
+			hasError = p.diags.errorfln("error in RedirectTo of match %d: %s", i, err.Error())
+			continue
+		}
+		for _, alias := range aliases {
+			aliasStr, isString := alias.(string)
+			if !isString {
+				hasError = p.diags.errorfln("alias %+v for redirect target %q is not a string", alias, target)
+				continue
+			}
+			err := checkRedirectPath(aliasStr)
+			if err != nil {
+				hasError = p.diags.errorfln("alias %q for redirect target %q %s", aliasStr, target, err.Error())
+				continue
+			}
+
+			redirect := Redirect{
+				PrefixURLPath(p.outputPrefix, RedirectSourcePath(aliasStr)),
+				PrefixURLPath(p.outputPrefix, target),
+			}
+			redirects = append(redirects, redirect)
+
+			var stub []byte
+			if mapping.Template != "" {
+				var output bytes.Buffer
+				tmplData := map[string]any{
+					"From": redirect.From,
+					"To":   redirect.To,
+					"Item": typedMatches[i],
+				}
+				p.translator.pagePath = RedirectOutputPath(aliasStr)
+				err := p.templates.Execute(mapping.Template, tmplData, &output)
+				if err != nil {
+					hasError = p.diags.errorfln("error executing redirect template: %s", err.Error())
+					continue
+				}
+				stub = output.Bytes()
+			} else {
+				stub = RedirectStub(redirect.To)
+			}
+
+			newError := p.writeOutput(RedirectOutputPath(aliasStr), stub)
+			hasError = hasError || newError
+		}
+	}
+
+	if mapping.RedirectsFile != "" {
+		newError := p.writeOutput(mapping.RedirectsFile, RedirectsFileContents(redirects))
+		hasError = hasError || newError
+	}
+	if mapping.NginxMapFile != "" {
+		newError := p.writeOutput(mapping.NginxMapFile, NginxMapContents(redirects))
+		hasError = hasError || newError
+	}
+
+	return hasError
+}
+
+// redirectAliases evaluates the Aliases expression against a match. Most
+// matches have no aliases, so null results are dropped, and list results
+// contribute each of their elements. Both jq:.aliases and jq:.aliases[]? work.
+func redirectAliases(expr string, item any) []any {
+	var aliases []any
+	for _, result := range EvalContentExpr(expr, item) {
+		switch typed := result.(type) {
+		case nil:
+		case []any:
+			aliases = append(aliases, typed...)
+		default:
+			aliases = append(aliases, typed)
+		}
+	}
+	return aliases
+}
+
+// redirectTarget evaluates the RedirectTo expression against a match, which
+// must produce a single path.
+func redirectTarget(expr string, item any) (string, error) {
+	matches := EvalContentExpr(expr, item)
+	if len(matches) != 1 {
+		return "", fmt.Errorf("%q produced %d values, not 1", expr, len(matches))
+	}
+	target, isString := matches[0].(string)
+	if !isString {
+		return "", fmt.Errorf("%q produced %+v, not a path", expr, matches[0])
+	}
+	err := checkRedirectPath(target)
+	if err != nil {
+		return "", fmt.Errorf("%q produced %q, which %s", expr, target, err.Error())
+	}
+	return target, nil
+}
+
+// checkRedirectPath rejects paths which can't be written to redirect files,
+// whose fields are separated by whitespace and, for nginx, ended by ";".
+func checkRedirectPath(redirectPath string) error {
+	if strings.TrimSpace(redirectPath) == "" {
+		return fmt.Errorf("is empty")
+	}
+	if strings.ContainsFunc(redirectPath, func(r rune) bool { return unicode.IsSpace(r) || r == ';' }) {
+		return fmt.Errorf("contains whitespace or \";\"")
+	}
+	return nil
+}
+
+// RedirectSourcePath normalizes an alias into an absolute URL path, as used
+// in server-side redirect files.
+func RedirectSourcePath(alias string) string {
+	return "/" + strings.TrimPrefix(alias, "/")
+}
+
+// RedirectOutputPath returns the output-relative file path where the redirect
+// stub for an alias is written. Aliases that look like directories get an
+// index.html inside them.
+func RedirectOutputPath(alias string) string {
+	relPath := strings.TrimPrefix(alias, "/")
+	if relPath == "" || strings.HasSuffix(relPath, "/") || path.Ext(relPath) == "" {
+		return path.Join(relPath, "index.html")
+	}
+	return relPath
+}
+
+func RedirectStub(target string) []byte {
+	escaped := html.EscapeString(target)
+	return []byte(fmt.Sprintf(`<!DOCTYPE html>
+<html>
+    <head>
+        <title>Redirecting to %[1]s</title>
+        <link rel="canonical" href="%[1]s" />
+        <meta http-equiv="refresh" content="0; url=%[1]s" />
+        <meta name="robots" content="noindex" />
+    </head>
+    <body>
+        <a href="%[1]s">Redirecting to %[1]s</a>
+    </body>
+</html>
+`, escaped))
+}
+
+// RedirectsFileContents produces a Netlify/Cloudflare-style _redirects file.
+func RedirectsFileContents(redirects []Redirect) []byte {
+	var buf bytes.Buffer
+	for _, redirect := range redirects {
+		fmt.Fprintf(&buf, "%s %s 301\n", redirect.From, redirect.To)
+	}
+	return buf.Bytes()
+}
+
+// NginxMapContents produces the body of an nginx map block, suitable for
+// including inside `map $uri $redirect_uri { ... }`.
+func NginxMapContents(redirects []Redirect) []byte {
+	var buf bytes.Buffer
+	for _, redirect := range redirects {
+		fmt.Fprintf(&buf, "%s %s;\n", redirect.From, redirect.To)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,83 @@
+package processor_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/treaster/incant/processor"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedirectOutputPath(t *testing.T) {
+	require.Equal(t, "old/recipe.html", processor.RedirectOutputPath("/old/recipe.html"))
+	require.Equal(t, "old/recipe/index.html", processor.RedirectOutputPath("/old/recipe/"))
+	require.Equal(t, "old/recipe/index.html", processor.RedirectOutputPath("old/recipe"))
+	require.Equal(t, "index.html", processor.RedirectOutputPath("/"))
+}
+
+func TestRedirectFiles(t *testing.T) {
+	redirects := []processor.Redirect{
+		{processor.RedirectSourcePath("old.html"), "/new.html"},
+		{processor.RedirectSourcePath("/older/"), "/new.html"},
+	}
+
+	require.Equal(t, "/old.html /new.html 301\n/older/ /new.html 301\n", string(processor.RedirectsFileContents(redirects)))
+	require.Equal(t, "/old.html /new.html;\n/older/ /new.html;\n", string(processor.NginxMapContents(redirects)))
+}
+
+func TestRedirectMappingWithoutAliases(t *testing.T) {
+	files := buildTestSite(map[string]string{"page.html": `{{.name}}`})
+	files["site/content/site.yaml"] = `
+pages:
+  - name: a
+    aliases: [old/a.html, older/a/]
+  - name: b
+`
+	for _, aliases := range []string{"jq:.aliases", "jq:.aliases[]?"} {
+		files["site/content/mapping.yaml"] = `
+- Aliases: ` + aliases + `
+  RedirectTo: jq:"/" + .name + ".html"
+  Selector: jq:.pages[]
+  RedirectsFile: _redirects
+`
+		result, err := processor.Build(context.Background(), processor.BuildOptions{
+			SiteFS:     mapFS(files),
+			ConfigPath: "site/config.yaml",
+		})
+		require.NoError(t, err, aliases)
+		require.Equal(t, "/old/a.html /a.html 301\n/older/a/ /a.html 301\n", string(result.Files["_redirects"]), aliases)
+		require.Contains(t, result.Files, "old/a.html", aliases)
+		require.Contains(t, result.Files, "older/a/index.html", aliases)
+	}
+}
+
+func TestRedirectMappingErrors(t *testing.T) {
+	files := buildTestSite(map[string]string{"page.html": `{{.name}}`})
+	files["site/content/mapping.yaml"] = `
+- Aliases: jq:.aliases
+  RedirectTo: jq:.target
+  Selector: jq:.pages[]
+  RedirectsFile: _redirects
+`
+	for content, expectedError := range map[string]string{
+		// Matches without aliases don't need a target.
+		"pages: [{name: a}]":                                     "",
+		"pages: [{name: a, aliases: [old.html]}]":                `"jq:.target" produced <nil>, not a path`,
+		"pages: [{name: a, aliases: [old.html], target: a b}]":   `"jq:.target" produced "a b", which contains whitespace`,
+		"pages: [{name: a, aliases: [old one.html], target: a}]": `alias "old one.html" for redirect target "a" contains whitespace`,
+		"pages: [{name: a, aliases: [old.html;], target: a}]":    `alias "old.html;" for redirect target "a" contains whitespace or ";"`,
+	} {
+		files["site/content/site.yaml"] = content
+		result, err := processor.Build(context.Background(), processor.BuildOptions{
+			SiteFS:     mapFS(files),
+			ConfigPath: "site/config.yaml",
+		})
+		if expectedError == "" {
+			require.NoError(t, err, content)
+			continue
+		}
+		require.ErrorIs(t, err, processor.ErrBuildFailed, content)
+		require.Contains(t, result.Diagnostics[0].Message, expectedError, content)
+	}
+}
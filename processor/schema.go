@@ -0,0 +1,430 @@
+package processor
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Schema validates content against a JSON Schema. Only a subset of draft
+// 2020-12 is supported:
+//   - type, enum, const
+//   - properties, required, additionalProperties, minProperties, maxProperties
+//   - items, prefixItems, minItems, maxItems, uniqueItems
+//   - minLength, maxLength, pattern
+//   - minimum, maximum, exclusiveMinimum, exclusiveMaximum, multipleOf
+//   - allOf, anyOf, oneOf, not
+//   - $defs, and $ref to local "#/..." pointers
+//
+// Other keywords are ignored, as the spec requires for unknown keywords.
+type Schema struct {
+	root any
+}
+
+func ParseSchema(raw any) (*Schema, error) {
+	switch raw.(type) {
+	case bool, map[string]any:
+		return &Schema{raw}, nil
+	default:
+		return nil, fmt.Errorf("schema must be a map or a boolean, got %T", raw)
+	}
+}
+
+// LoadSchema reads a schema file in any of the loader's formats.
+func LoadSchema(loader FileLoader, schemaPath string) (*Schema, error) {
+	var raw any
+	err := loader.LoadFile(schemaPath, &raw)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSchema(raw)
+}
+
+// Validate returns one error per violation. Each error includes the path to
+// the offending value, starting from stack, in the same format used for
+// content evaluation errors.
+func (s *Schema) Validate(value any, stack []string) []error {
+	v := schemaValidator{s.root, nil, map[string]bool{}}
+	v.validate(s.root, value, stack)
+	return v.errors
+}
+
+type schemaValidator struct {
+	root   any
+	errors []error
+	// resolving holds the $refs being resolved for the current value. A $ref
+	// which is resolved again before descending into the value is a cycle.
+	resolving map[string]bool
+}
+
+func (v *schemaValidator) addError(stack []string, s string, args ...any) {
+	errorStr := fmt.Sprintf(s, args...)
+	stackStr := fmt.Sprintf("stack: [%s]", strings.Join(stack, " -> "))
+	v.errors = append(v.errors, fmt.Errorf("%s (%s)", errorStr, stackStr))
+}
+
+// isValid runs a validation in isolation, for the combinators which need to
+// know whether a subschema matched without reporting its errors.
+func (v *schemaValidator) isValid(schema any, value any, stack []string) bool {
+	sub := schemaValidator{v.root, nil, v.resolving}
+	sub.validate(schema, value, stack)
+	return len(sub.errors) == 0
+}
+
+func (v *schemaValidator) validate(schema any, value any, stack []string) {
+	switch typed := schema.(type) {
+	case bool:
+		if !typed {
+			v.addError(stack, "no value is allowed here")
+		}
+		return
+	case map[string]any:
+		v.validateMap(typed, value, stack)
+	default:
+		v.addError(stack, "invalid schema of type %T", schema)
+	}
+}
+
+// validateChild validates a value nested in the current one. $refs resolved
+// for the current value may be resolved again for the child, as in recursive
+// schemas.
+func (v *schemaValidator) validateChild(schema any, value any, stack []string) {
+	resolving := v.resolving
+	v.resolving = map[string]bool{}
+	v.validate(schema, value, stack)
+	v.resolving = resolving
+}
+
+func (v *schemaValidator) validateMap(schema map[string]any, value any, stack []string) {
+	if ref, hasRef := schema["$ref"]; hasRef {
+		refStr, _ := ref.(string)
+		if v.resolving[refStr] {
+			v.addError(stack, "circular $ref %q", refStr)
+			return
+		}
+		target, err := v.resolveRef(refStr)
+		if err != nil {
+			v.addError(stack, "%s", err.Error())
+			return
+		}
+		v.resolving[refStr] = true
+		v.validate(target, value, stack)
+		delete(v.resolving, refStr)
+	}
+
+	if typeValue, hasType := schema["type"]; hasType {
+		var allowed []string
+		switch typedType := typeValue.(type) {
+		case string:
+			allowed = []string{typedType}
+		case []any:
+			for _, t := range typedType {
+				tStr, _ := t.(string)
+				allowed = append(allowed, tStr)
+			}
+		}
+
+		isMatch := false
+		for _, t := range allowed {
+			if schemaTypeMatches(t, value) {
+				isMatch = true
+				break
+			}
+		}
+		if !isMatch {
+			v.addError(stack, "expected type %s, got %s", strings.Join(allowed, " or "), schemaTypeName(value))
+			// Further checks would only produce confusing follow-on errors.
+			return
+		}
+	}
+
+	if constValue, hasConst := schema["const"]; hasConst {
+		if !schemaEqual(constValue, value) {
+			v.addError(stack, "expected %v, got %v", constValue, value)
+		}
+	}
+
+	if enumValue, hasEnum := schema["enum"]; hasEnum {
+		options, _ := enumValue.([]any)
+		isMatch := false
+		for _, option := range options {
+			if schemaEqual(option, value) {
+				isMatch = true
+				break
+			}
+		}
+		if !isMatch {
+			v.addError(stack, "expected one of %v, got %v", options, value)
+		}
+	}
+
+	switch typedValue := value.(type) {
+	case map[string]any:
+		v.validateObject(schema, typedValue, stack)
+	case []any:
+		v.validateArray(schema, typedValue, stack)
+	case string:
+		v.validateString(schema, typedValue, stack)
+	default:
+		number, isNumber := schemaNumber(value)
+		if isNumber {
+			v.validateNumber(schema, number, stack)
+		}
+	}
+
+	v.validateCombinators(schema, value, stack)
+}
+
+func (v *schemaValidator) validateObject(schema map[string]any, value map[string]any, stack []string) {
+	if required, hasRequired := schema["required"].([]any); hasRequired {
+		for _, key := range required {
+			keyStr, _ := key.(string)
+			if _, hasKey := value[keyStr]; !hasKey {
+				v.addError(stack, "missing required key %q", keyStr)
+			}
+		}
+	}
+
+	if minProperties, hasMin := schemaNumber(schema["minProperties"]); hasMin && float64(len(value)) < minProperties {
+		v.addError(stack, "expected at least %v keys, got %d", minProperties, len(value))
+	}
+	if maxProperties, hasMax := schemaNumber(schema["maxProperties"]); hasMax && float64(len(value)) > maxProperties {
+		v.addError(stack, "expected at most %v keys, got %d", maxProperties, len(value))
+	}
+
+	properties, _ := schema["properties"].(map[string]any)
+	additional, hasAdditional := schema["additionalProperties"]
+
+	// Iterate in sorted order so that errors are reported deterministically.
+	keys := make([]string, 0, len(value))
+	for key := range value {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		keyStack := appendStack(stack, key)
+		propertySchema, hasProperty := properties[key]
+		if hasProperty {
+			v.validateChild(propertySchema, value[key], keyStack)
+		} else if hasAdditional {
+			if additional == false {
+				v.addError(keyStack, "unexpected key %q", key)
+			} else {
+				v.validateChild(additional, value[key], keyStack)
+			}
+		}
+	}
+}
+
+func (v *schemaValidator) validateArray(schema map[string]any, value []any, stack []string) {
+	if minItems, hasMin := schemaNumber(schema["minItems"]); hasMin && float64(len(value)) < minItems {
+		v.addError(stack, "expected at least %v items, got %d", minItems, len(value))
+	}
+	if maxItems, hasMax := schemaNumber(schema["maxItems"]); hasMax && float64(len(value)) > maxItems {
+		v.addError(stack, "expected at most %v items, got %d", maxItems, len(value))
+	}
+
+	if unique, _ := schema["uniqueItems"].(bool); unique {
+		for i := 0; i < len(value); i++ {
+			for j := i + 1; j < len(value); j++ {
+				if schemaEqual(value[i], value[j]) {
+					v.addError(stack, "items %d and %d are equal, but items must be unique", i, j)
+				}
+			}
+		}
+	}
+
+	prefixItems, _ := schema["prefixItems"].([]any)
+	items, hasItems := schema["items"]
+	for i, item := range value {
+		itemStack := appendStack(stack, fmt.Sprintf("[%d]", i))
+		if i < len(prefixItems) {
+			v.validateChild(prefixItems[i], item, itemStack)
+		} else if hasItems {
+			v.validateChild(items, item, itemStack)
+		}
+	}
+}
+
+func (v *schemaValidator) validateString(schema map[string]any, value string, stack []string) {
+	length := float64(utf8.RuneCountInString(value))
+	if minLength, hasMin := schemaNumber(schema["minLength"]); hasMin && length < minLength {
+		v.addError(stack, "expected at least %v characters, got %v", minLength, length)
+	}
+	if maxLength, hasMax := schemaNumber(schema["maxLength"]); hasMax && length > maxLength {
+		v.addError(stack, "expected at most %v characters, got %v", maxLength, length)
+	}
+
+	if pattern, hasPattern := schema["pattern"].(string); hasPattern {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			v.addError(stack, "invalid schema pattern %q: %s", pattern, err.Error())
+		} else if !re.MatchString(value) {
+			v.addError(stack, "%q does not match pattern %q", value, pattern)
+		}
+	}
+}
+
+func (v *schemaValidator) validateNumber(schema map[string]any, value float64, stack []string) {
+	if minimum, hasMin := schemaNumber(schema["minimum"]); hasMin && value < minimum {
+		v.addError(stack, "expected a value >= %v, got %v", minimum, value)
+	}
+	if maximum, hasMax := schemaNumber(schema["maximum"]); hasMax && value > maximum {
+		v.addError(stack, "expected a value <= %v, got %v", maximum, value)
+	}
+	if minimum, hasMin := schemaNumber(schema["exclusiveMinimum"]); hasMin && value <= minimum {
+		v.addError(stack, "expected a value > %v, got %v", minimum, value)
+	}
+	if maximum, hasMax := schemaNumber(schema["exclusiveMaximum"]); hasMax && value >= maximum {
+		v.addError(stack, "expected a value < %v, got %v", maximum, value)
+	}
+	if multipleOf, hasMultiple := schemaNumber(schema["multipleOf"]); hasMultiple && multipleOf != 0 {
+		quotient := value / multipleOf
+		if quotient != math.Trunc(quotient) {
+			v.addError(stack, "expected a multiple of %v, got %v", multipleOf, value)
+		}
+	}
+}
+
+func (v *schemaValidator) validateCombinators(schema map[string]any, value any, stack []string) {
+	if allOf, hasAllOf := schema["allOf"].([]any); hasAllOf {
+		for _, sub := range allOf {
+			v.validate(sub, value, stack)
+		}
+	}
+
+	if anyOf, hasAnyOf := schema["anyOf"].([]any); hasAnyOf {
+		isMatch := false
+		for _, sub := range anyOf {
+			if v.isValid(sub, value, stack) {
+				isMatch = true
+				break
+			}
+		}
+		if !isMatch {
+			v.addError(stack, "value does not match any of the anyOf schemas")
+		}
+	}
+
+	if oneOf, hasOneOf := schema["oneOf"].([]any); hasOneOf {
+		numMatches := 0
+		for _, sub := range oneOf {
+			if v.isValid(sub, value, stack) {
+				numMatches++
+			}
+		}
+		if numMatches != 1 {
+			v.addError(stack, "value must match exactly one of the oneOf schemas, matched %d", numMatches)
+		}
+	}
+
+	if not, hasNot := schema["not"]; hasNot {
+		if v.isValid(not, value, stack) {
+			v.addError(stack, "value must not match the \"not\" schema")
+		}
+	}
+}
+
+func (v *schemaValidator) resolveRef(ref string) (any, error) {
+	pointer, isLocal := strings.CutPrefix(ref, "#")
+	if !isLocal {
+		return nil, fmt.Errorf("unsupported $ref %q: only local references are supported", ref)
+	}
+
+	current := v.root
+	for _, part := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		if part == "" {
+			continue
+		}
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		currentMap, isMap := current.(map[string]any)
+		if !isMap {
+			return nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+		next, hasNext := currentMap[part]
+		if !hasNext {
+			return nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+		current = next
+	}
+	return current, nil
+}
+
+func appendStack(stack []string, key string) []string {
+	newStack := make([]string, len(stack), len(stack)+1)
+	copy(newStack, stack)
+	return append(newStack, key)
+}
+
+func schemaTypeMatches(schemaType string, value any) bool {
+	switch schemaType {
+	case "null":
+		return value == nil
+	case "boolean":
+		_, isBool := value.(bool)
+		return isBool
+	case "object":
+		_, isMap := value.(map[string]any)
+		return isMap
+	case "array":
+		_, isList := value.([]any)
+		return isList
+	case "string":
+		switch value.(type) {
+		case string, time.Time:
+			return true
+		}
+		return false
+	case "number":
+		_, isNumber := schemaNumber(value)
+		return isNumber
+	case "integer":
+		number, isNumber := schemaNumber(value)
+		return isNumber && number == math.Trunc(number)
+	default:
+		return false
+	}
+}
+
+func schemaTypeName(value any) string {
+	for _, t := range []string{"null", "boolean", "object", "array", "string", "integer", "number"} {
+		if schemaTypeMatches(t, value) {
+			return t
+		}
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// schemaNumber converts any of the numeric types produced by the various
+// content decoders into a float64.
+func schemaNumber(value any) (float64, bool) {
+	if value == nil {
+		return 0, false
+	}
+	rv := reflect.ValueOf(value)
+	switch {
+	case rv.CanInt():
+		return float64(rv.Int()), true
+	case rv.CanUint():
+		return float64(rv.Uint()), true
+	case rv.CanFloat():
+		return rv.Float(), true
+	default:
+		return 0, false
+	}
+}
+
+func schemaEqual(a any, b any) bool {
+	aNumber, aIsNumber := schemaNumber(a)
+	bNumber, bIsNumber := schemaNumber(b)
+	if aIsNumber && bIsNumber {
+		return aNumber == bNumber
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,131 @@
+package processor_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/treaster/incant/processor"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaValidate(t *testing.T) {
+	loader := makeFileLoader(map[string]string{
+		"recipes.schema.yaml": `
+            type: object
+            required: [recipes]
+            properties:
+                recipes:
+                    type: array
+                    items: {$ref: "#/$defs/recipe"}
+            $defs:
+                recipe:
+                    type: object
+                    required: [shortname, title]
+                    additionalProperties: false
+                    properties:
+                        shortname: {type: string, pattern: "^[a-z-]+$"}
+                        title: {type: string, minLength: 1}
+                        servings: {type: integer, minimum: 1}
+                        tag: {enum: [dessert, pasta]}
+            `,
+	})
+
+	schema, err := processor.LoadSchema(loader, "recipes.schema.yaml")
+	require.NoError(t, err)
+
+	valid := map[string]any{
+		"recipes": []any{
+			map[string]any{"shortname": "spaghetti", "title": "Spaghetti", "servings": 4, "tag": "pasta"},
+		},
+	}
+	require.Equal(t, 0, len(schema.Validate(valid, []string{"file:site.yaml"})))
+
+	invalid := map[string]any{
+		"recipes": []any{
+			map[string]any{"shortname": "spaghetti", "title": "Spaghetti"},
+			map[string]any{"shortName": "Cake", "title": "Cake", "servings": 1.5, "tag": "cake"},
+		},
+	}
+	errs := schema.Validate(invalid, []string{"file:site.yaml"})
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	require.Equal(t, []string{
+		`missing required key "shortname" (stack: [file:site.yaml -> recipes -> [1]])`,
+		`expected type integer, got number (stack: [file:site.yaml -> recipes -> [1] -> servings])`,
+		`unexpected key "shortName" (stack: [file:site.yaml -> recipes -> [1] -> shortName])`,
+		`expected one of [dessert pasta], got cake (stack: [file:site.yaml -> recipes -> [1] -> tag])`,
+	}, messages)
+}
+
+func TestSchemaCombinators(t *testing.T) {
+	schema, err := processor.ParseSchema(map[string]any{
+		"oneOf": []any{
+			map[string]any{"type": "string"},
+			map[string]any{"type": "integer", "not": map[string]any{"const": 0}},
+		},
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, 0, len(schema.Validate("abc", nil)))
+	require.Equal(t, 0, len(schema.Validate(3, nil)))
+	require.Equal(t, 1, len(schema.Validate(0, nil)))
+	require.Equal(t, 1, len(schema.Validate(true, nil)))
+}
+
+func TestSchemaRefCycles(t *testing.T) {
+	// A recursive schema is fine, since each $ref descends into the value.
+	tree, err := processor.ParseSchema(map[string]any{
+		"$ref": "#/$defs/node",
+		"$defs": map[string]any{
+			"node": map[string]any{
+				"required":   []any{"name"},
+				"properties": map[string]any{"children": map[string]any{"items": map[string]any{"$ref": "#/$defs/node"}}},
+			},
+		},
+	})
+	require.NoError(t, err)
+	value := map[string]any{"name": "a", "children": []any{map[string]any{"name": "b", "children": []any{map[string]any{}}}}}
+	errs := tree.Validate(value, nil)
+	require.Equal(t, 1, len(errs))
+	require.Contains(t, errs[0].Error(), `missing required key "name"`)
+
+	for _, raw := range []map[string]any{
+		{"$ref": "#"},
+		{
+			"$ref": "#/$defs/a",
+			"$defs": map[string]any{
+				"a": map[string]any{"$ref": "#/$defs/b"},
+				"b": map[string]any{"$ref": "#/$defs/a"},
+			},
+		},
+	} {
+		schema, err := processor.ParseSchema(raw)
+		require.NoError(t, err)
+		errs := schema.Validate("x", nil)
+		require.Equal(t, 1, len(errs))
+		require.Contains(t, errs[0].Error(), "circular $ref")
+	}
+}
+
+func TestMappingSchemaStopsRendering(t *testing.T) {
+	files := buildTestSite(map[string]string{"page.html": `{{.name}}`})
+	files["site/content/page.schema.yaml"] = `required: [slug]`
+	files["site/content/site.yaml"] = `pages: [{name: a, slug: a}, {name: b}]`
+	files["site/content/mapping.yaml"] = `
+- PerMatchOutput: jq:.slug + ".html"
+  Template: page.html
+  Selector: jq:.pages[]
+  Schema: page.schema.yaml
+`
+	result, err := processor.Build(context.Background(), processor.BuildOptions{
+		SiteFS:     mapFS(files),
+		ConfigPath: "site/config.yaml",
+	})
+	require.ErrorIs(t, err, processor.ErrBuildFailed)
+	require.Equal(t, 1, len(result.Diagnostics))
+	require.Contains(t, result.Diagnostics[0].Message, `missing required key "slug"`)
+	require.Empty(t, result.Outputs)
+}
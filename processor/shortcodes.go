@@ -0,0 +1,185 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/goldmark"
+)
+
+// ShortcodesDir is the directory, relative to TemplatesRoot, which holds the
+// templates for Markdown shortcodes. The shortcode {{< figure >}} is rendered
+// by shortcodes/figure.html, or any other file named figure.* there.
+const ShortcodesDir = "shortcodes/"
+
+// ShortcodeData is passed to shortcode templates.
+type ShortcodeData struct {
+	Name string
+	// Params holds the key="value" arguments, and Args the positional ones.
+	Params map[string]string
+	Args   []string
+	// Inner is the unrendered content between {{< name >}} and
+	// {{< /name >}}, if the shortcode is paired.
+	Inner string
+	// Page is the data of the template calling RenderMarkdown.
+	Page any
+}
+
+var shortcodeTag = regexp.MustCompile(`\{\{<\s*(/)?\s*([\w-]+)((?:\s+(?:[\w-]+=)?(?:"(?:[^"\\]|\\.)*"|[^\s">]+))*)\s*>\}\}`)
+var shortcodeArg = regexp.MustCompile(`(?:([\w-]+)=)?("(?:[^"\\]|\\.)*"|[^\s"]+)`)
+
+// ParseShortcodeArgs splits the arguments of a shortcode tag into named and
+// positional arguments.
+func ParseShortcodeArgs(argString string) (map[string]string, []string, error) {
+	params := map[string]string{}
+	var args []string
+	for _, match := range shortcodeArg.FindAllStringSubmatch(argString, -1) {
+		value := match[2]
+		if strings.HasPrefix(value, `"`) {
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid quoted argument %s", value)
+			}
+			value = unquoted
+		}
+
+		if match[1] != "" {
+			params[match[1]] = value
+		} else {
+			args = append(args, value)
+		}
+	}
+	return params, args, nil
+}
+
+// ExpandShortcodes replaces every shortcode in input with a placeholder, so
+// that Markdown rendering leaves them intact, and returns the rendered output
+// for each placeholder. A shortcode is paired if a matching closing tag
+// follows it, otherwise it stands alone.
+func ExpandShortcodes(input string, render func(ShortcodeData) (string, error)) (string, map[string]string, error) {
+	var expanded strings.Builder
+	rendered := map[string]string{}
+
+	tags := shortcodeTag.FindAllStringSubmatchIndex(input, -1)
+	pos := 0
+	for i := 0; i < len(tags); i++ {
+		tag := tags[i]
+		if tag[0] < pos {
+			// Inside the content of a paired shortcode.
+			continue
+		}
+
+		name := input[tag[4]:tag[5]]
+		if tag[2] >= 0 {
+			return "", nil, fmt.Errorf("closing shortcode %q without an opening tag", name)
+		}
+
+		params, args, err := ParseShortcodeArgs(input[tag[6]:tag[7]])
+		if err != nil {
+			return "", nil, fmt.Errorf("shortcode %q: %s", name, err.Error())
+		}
+
+		data := ShortcodeData{name, params, args, "", nil}
+		end := tag[1]
+		for _, closing := range tags[i+1:] {
+			if closing[2] >= 0 && input[closing[4]:closing[5]] == name {
+				data.Inner = input[tag[1]:closing[0]]
+				end = closing[1]
+				break
+			}
+		}
+
+		output, err := render(data)
+		if err != nil {
+			return "", nil, fmt.Errorf("shortcode %q: %s", name, err.Error())
+		}
+
+		placeholder := fmt.Sprintf("incantshortcode%dplaceholder", len(rendered))
+		rendered[placeholder] = output
+
+		expanded.WriteString(input[pos:tag[0]])
+		expanded.WriteString(placeholder)
+		pos = end
+	}
+	expanded.WriteString(input[pos:])
+
+	return expanded.String(), rendered, nil
+}
+
+// replaceShortcodePlaceholders substitutes rendered shortcodes back into the
+// HTML produced from Markdown. A shortcode alone in a paragraph replaces the
+// whole paragraph.
+func replaceShortcodePlaceholders(html string, rendered map[string]string) string {
+	for placeholder, output := range rendered {
+		html = strings.ReplaceAll(html, "<p>"+placeholder+"</p>", output)
+		html = strings.ReplaceAll(html, placeholder, output)
+	}
+	return html
+}
+
+// shortcodeRenderer renders Markdown, executing shortcodes with the templates
+// in ShortcodesDir. Templates which escape their output get safeMarkdown,
+// which omits raw HTML, since they trust the HTML that RenderMarkdown returns.
+type shortcodeRenderer struct {
+	templates    *templateEngines
+	markdown     goldmark.Markdown
+	safeMarkdown goldmark.Markdown
+	autoEscape   bool
+}
+
+func (sr *shortcodeRenderer) RenderMarkdown(input string) (HTML, error) {
+	expanded, rendered, err := ExpandShortcodes(input, sr.renderShortcode)
+	if err != nil {
+		return "", err
+	}
+
+	markdown := sr.markdown
+	if sr.autoEscape || sr.templates.pageType == "go/html-template" {
+		markdown = sr.safeMarkdown
+	}
+	output, err := renderMarkdownWith(markdown, expanded)
+	if err != nil {
+		return "", err
+	}
+	return HTML(replaceShortcodePlaceholders(output, rendered)), nil
+}
+
+func (sr *shortcodeRenderer) renderShortcode(data ShortcodeData) (string, error) {
+	tmplName, hasTemplate := sr.shortcodeTemplate(data.Name)
+	if !hasTemplate {
+		return "", fmt.Errorf("no template for shortcode in %s", ShortcodesDir)
+	}
+
+	data.Page = sr.templates.page
+
+	// The shortcode template executes with the same page as its caller, so it
+	// bypasses templateEngines.Execute.
+	var output bytes.Buffer
+	err := sr.templates.MgrFor(tmplName).Execute(tmplName, data, &output)
+	if err != nil {
+		return "", err
+	}
+	return output.String(), nil
+}
+
+func (sr *shortcodeRenderer) shortcodeTemplate(name string) (string, bool) {
+	var candidates []string
+	for tmplName := range sr.templates.names {
+		base := strings.TrimPrefix(tmplName, ShortcodesDir)
+		if base == tmplName || strings.Contains(base, "/") {
+			continue
+		}
+		if base == name || strings.HasPrefix(base, name+".") {
+			candidates = append(candidates, tmplName)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", false
+	}
+	sort.Strings(candidates)
+	return candidates[0], true
+}
@@ -0,0 +1,104 @@
+package processor_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/treaster/incant/processor"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandShortcodes(t *testing.T) {
+	var calls []processor.ShortcodeData
+	expanded, rendered, err := processor.ExpandShortcodes(
+		`a {{< figure src="a b.png" wide >}} b {{< note >}}*hi*{{< /note >}} c`,
+		func(data processor.ShortcodeData) (string, error) {
+			calls = append(calls, data)
+			return "<" + data.Name + ">", nil
+		})
+	require.NoError(t, err)
+	require.Equal(t, "a incantshortcode0placeholder b incantshortcode1placeholder c", expanded)
+	require.Equal(t, map[string]string{
+		"incantshortcode0placeholder": "<figure>",
+		"incantshortcode1placeholder": "<note>",
+	}, rendered)
+
+	require.Equal(t, []processor.ShortcodeData{
+		{Name: "figure", Params: map[string]string{"src": "a b.png"}, Args: []string{"wide"}},
+		{Name: "note", Params: map[string]string{}, Inner: "*hi*"},
+	}, calls)
+
+	_, _, err = processor.ExpandShortcodes(`{{< /note >}}`, nil)
+	require.Error(t, err)
+}
+
+func TestShortcodesInMarkdown(t *testing.T) {
+	siteRoot := t.TempDir()
+	writeFiles(t, siteRoot, map[string]string{
+		"config.yaml": `
+ContentRoot: content
+SiteContentFile: site.yaml
+MappingFile: mapping.yaml
+TemplatesRoot: templates
+TemplatesType: go/template
+StaticRoot: static
+OutputRoot: output
+`,
+		"content/site.yaml": `
+title: Cake
+body: |
+  Intro *text*.
+
+  {{< figure src="cake.png" >}}
+
+  {{< note >}}Inner *note*{{< /note >}}
+`,
+		"content/mapping.yaml": `
+- PerMatchOutput: jq:"page.html"
+  Template: page.html
+  Selector: jq:.
+`,
+		"templates/page.html":              `{{RenderMarkdown .body}}`,
+		"templates/shortcodes/figure.html": `<figure><img src="{{.Params.src}}" alt="{{.Page.title}}"></figure>`,
+		"templates/shortcodes/note.jet":    `<aside>{{ RenderMarkdown(.Inner) }}</aside>`,
+	})
+
+	buildSite(t, siteRoot, func(config *processor.Config) {
+		config.TemplatesTypeByExtension = map[string]string{".jet": "jet"}
+	})
+
+	output, err := os.ReadFile(filepath.Join(siteRoot, "output", "page.html"))
+	require.NoError(t, err)
+	require.Equal(t, "<p>Intro <em>text</em>.</p>\n"+
+		`<figure><img src="cake.png" alt="Cake"></figure>`+"\n"+
+		"<aside><p>Inner <em>note</em></p>\n</aside>\n", string(output))
+}
+
+func TestRenderMarkdownEscaping(t *testing.T) {
+	body := `hi <script>alert(1)</script> [link](javascript:alert(1))`
+	for _, tc := range []struct {
+		templatesType string
+		autoEscape    bool
+		expected      string
+	}{
+		{"go/template", false, `<p>hi <script>alert(1)</script> <a href="javascript:alert(1)">link</a></p>` + "\n"},
+		{"go/template", true, `<p>hi <!-- raw HTML omitted -->alert(1)<!-- raw HTML omitted --> <a href="">link</a></p>` + "\n"},
+		{"go/html-template", false, `<p>hi <!-- raw HTML omitted -->alert(1)<!-- raw HTML omitted --> <a href="">link</a></p>` + "\n"},
+	} {
+		files := buildTestSite(map[string]string{"page.html": `{{RenderMarkdown .body}}`})
+		files["site/content/site.yaml"] = "pages: [{name: a, body: \"" + body + "\"}]"
+		result, err := processor.Build(context.Background(), processor.BuildOptions{
+			SiteFS:     mapFS(files),
+			ConfigPath: "site/config.yaml",
+			OverrideConfig: func(config *processor.Config) {
+				config.TemplatesType = tc.templatesType
+				config.AutoEscape = tc.autoEscape
+			},
+		})
+		require.NoError(t, err, tc.templatesType)
+		require.Equal(t, tc.expected, string(result.Files["a.html"]), tc.templatesType)
+	}
+}
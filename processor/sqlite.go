@@ -0,0 +1,255 @@
+package processor
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+const (
+	sqliteKey        = "$sqlite"
+	sqliteTablesKey  = "tables"
+	sqliteQueriesKey = "queries"
+)
+
+// evalSQLite evaluates a content map with a $sqlite key, which names a SQLite
+// database relative to the content root:
+//
+//	shop:
+//	  $sqlite: shop.db
+//	  tables: [products]
+//	  queries:
+//	    bestsellers: SELECT name FROM products ORDER BY sales DESC LIMIT 3
+//
+// The map is replaced by a map of each table, and the result of each named
+// query, as a list of rows keyed by column name. Without tables or queries,
+// every table is included. The database is opened read-only.
+func evalSQLite(ctx *evalContext, content map[string]any) any {
+	dbPath, isString := content[sqliteKey].(string)
+	if !isString {
+		ctx.addError("%s must be a path, got %T", sqliteKey, content[sqliteKey])
+		return nil
+	}
+
+	var tables []string
+	queries := map[string]string{}
+	for key, value := range content {
+		switch key {
+		case sqliteKey:
+		case sqliteTablesKey:
+			list, isList := value.([]any)
+			if !isList {
+				ctx.addError("%s %s must be a list of table names, got %T", sqliteKey, sqliteTablesKey, value)
+				return nil
+			}
+			for _, item := range list {
+				table, isString := item.(string)
+				if !isString {
+					ctx.addError("%s %s must be a list of table names, got a %T", sqliteKey, sqliteTablesKey, item)
+					return nil
+				}
+				tables = append(tables, table)
+			}
+		case sqliteQueriesKey:
+			queryMap, isMap := value.(map[string]any)
+			if !isMap {
+				ctx.addError("%s %s must be a map of names to queries, got %T", sqliteKey, sqliteQueriesKey, value)
+				return nil
+			}
+			for name, query := range queryMap {
+				queryString, isString := query.(string)
+				if !isString {
+					ctx.addError("%s query %q must be a string, got %T", sqliteKey, name, query)
+					return nil
+				}
+				queries[name] = queryString
+			}
+		default:
+			ctx.addError("unrecognized key %q alongside %s; expected %s or %s", key, sqliteKey, sqliteTablesKey, sqliteQueriesKey)
+			return nil
+		}
+	}
+
+	db, cleanup, err := openSQLite(ctx.loader, dbPath)
+	if err != nil {
+		ctx.addError("unable to open SQLite database %q: %s", dbPath, err.Error())
+		return nil
+	}
+	defer cleanup()
+
+	if len(tables) == 0 && len(queries) == 0 {
+		tables, err = sqliteTables(db)
+		if err != nil {
+			ctx.addError("unable to list tables of SQLite database %q: %s", dbPath, err.Error())
+			return nil
+		}
+	}
+
+	result := map[string]any{}
+	for _, table := range tables {
+		rows, err := sqliteQuery(db, fmt.Sprintf("SELECT * FROM %s", quoteSQLiteIdent(table)))
+		if err != nil {
+			ctx.addError("unable to read table %q of SQLite database %q: %s", table, dbPath, err.Error())
+			return nil
+		}
+		result[table] = rows
+	}
+	for name, query := range queries {
+		if _, isTable := result[name]; isTable {
+			ctx.addError("query %q has the same name as a table of SQLite database %q", name, dbPath)
+			return nil
+		}
+		rows, err := sqliteQuery(db, query)
+		if err != nil {
+			ctx.addError("unable to run query %q on SQLite database %q: %s", name, dbPath, err.Error())
+			return nil
+		}
+		result[name] = rows
+	}
+	return result
+}
+
+// openSQLite opens a copy of a database. Since the loader's files need not be
+// on disk, the database is copied to a temporary directory, which cleanup
+// removes. Tools which keep a database open in WAL mode have recent writes in
+// its -wal file, so that is copied too.
+func openSQLite(loader FileLoader, dbPath string) (*sql.DB, func(), error) {
+	contents, walContents, err := readSQLite(loader, dbPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tmpDir, err := os.MkdirTemp("", "incant-sqlite-")
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpPath := filepath.Join(tmpDir, "content.db")
+	err = os.WriteFile(tmpPath, contents, 0600)
+	if err == nil && walContents != nil {
+		err = os.WriteFile(tmpPath+sqliteWALSuffix, walContents, 0600)
+	}
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		return nil, nil, err
+	}
+
+	db, err := sql.Open("sqlite", "file:"+tmpPath+"?mode=ro")
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		return nil, nil, err
+	}
+	cleanup := func() {
+		db.Close()
+		os.RemoveAll(tmpDir)
+	}
+	return db, cleanup, nil
+}
+
+const sqliteWALSuffix = "-wal"
+
+// readSQLite reads a database and its -wal file, if it has one. A checkpoint
+// moves writes from the -wal file into the database, so the two only agree if
+// the database is unchanged after both are read.
+func readSQLite(loader FileLoader, dbPath string) ([]byte, []byte, error) {
+	for attempt := 0; attempt < 3; attempt++ {
+		contents, err := loader.LoadFileAsBytes(dbPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		walContents, err := loader.LoadFileAsBytes(dbPath + sqliteWALSuffix)
+		if errors.Is(err, fs.ErrNotExist) {
+			return contents, nil, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		after, err := loader.LoadFileAsBytes(dbPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		if bytes.Equal(contents, after) {
+			return contents, walContents, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("the database kept changing while it was read")
+}
+
+// sqliteTables lists the tables of a database, in sorted order.
+func sqliteTables(db *sql.DB) ([]string, error) {
+	rows, err := db.Query(`SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var table string
+		err := rows.Scan(&table)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	return tables, rows.Err()
+}
+
+// sqliteQuery runs a query, returning each row as a map keyed by column name.
+func sqliteQuery(db *sql.DB, query string) ([]any, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	results := []any{}
+	for rows.Next() {
+		values := make([]any, len(columns))
+		pointers := make([]any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		err := rows.Scan(pointers...)
+		if err != nil {
+			return nil, err
+		}
+
+		row := make(map[string]any, len(columns))
+		for i, column := range columns {
+			row[column] = sqliteValue(values[i])
+		}
+		results = append(results, row)
+	}
+	return results, rows.Err()
+}
+
+// sqliteValue converts a scanned value to the types of other content:
+// integers become int and blobs become strings.
+func sqliteValue(value any) any {
+	switch typed := value.(type) {
+	case int64:
+		return int(typed)
+	case []byte:
+		return string(typed)
+	default:
+		return value
+	}
+}
+
+func quoteSQLiteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
@@ -0,0 +1,109 @@
+package processor_test
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/treaster/incant/processor"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvalContentSQLite(t *testing.T) {
+	siteRoot := t.TempDir()
+	writeFiles(t, siteRoot, map[string]string{
+		"content/site.yaml": `
+shop:
+  $sqlite: shop.db
+  tables: [products]
+  queries:
+    bestsellers: SELECT name FROM products WHERE sales > 5 ORDER BY sales DESC
+`,
+		"content/all.yaml":     `$sqlite: shop.db`,
+		"content/missing.yaml": `x: {$sqlite: missing.db}`,
+		"content/badsql.yaml":  `x: {$sqlite: shop.db, queries: {bad: SELECT nope FROM products}}`,
+		"content/badkey.yaml":  `x: {$sqlite: shop.db, table: products}`,
+	})
+
+	// The processor package registers the sqlite driver.
+	db, err := sql.Open("sqlite", filepath.Join(siteRoot, "content", "shop.db"))
+	require.NoError(t, err)
+	_, err = db.Exec(`
+CREATE TABLE products (name TEXT, price REAL, sales INTEGER, image BLOB);
+INSERT INTO products VALUES ('hat', 9.5, 3, 'hat.png'), ('mug', 4.25, 12, NULL), ('pen', 1, 7, NULL);
+CREATE TABLE "order items" (product TEXT);
+`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	loader := processor.MakeFileLoader(os.DirFS(siteRoot), "content", processor.DefaultDecoders())
+
+	products := []any{
+		map[string]any{"name": "hat", "price": 9.5, "sales": 3, "image": "hat.png"},
+		map[string]any{"name": "mug", "price": 4.25, "sales": 12, "image": nil},
+		map[string]any{"name": "pen", "price": 1.0, "sales": 7, "image": nil},
+	}
+	actual, errs := processor.EvalContentFile(loader, "site.yaml")
+	require.Equal(t, 0, len(errs))
+	require.Equal(t, map[string]any{
+		"shop": map[string]any{
+			"products": products,
+			"bestsellers": []any{
+				map[string]any{"name": "mug"},
+				map[string]any{"name": "pen"},
+			},
+		},
+	}, actual)
+
+	// Without tables or queries, every table is included.
+	actual, errs = processor.EvalContentFile(loader, "all.yaml")
+	require.Equal(t, 0, len(errs))
+	require.Equal(t, map[string]any{
+		"products":    products,
+		"order items": []any{},
+	}, actual)
+
+	for file, expectedError := range map[string]string{
+		"missing.yaml": `unable to open SQLite database "missing.db"`,
+		"badsql.yaml":  `unable to run query "bad" on SQLite database "shop.db"`,
+		"badkey.yaml":  `unrecognized key "table" alongside $sqlite`,
+	} {
+		_, errs := processor.EvalContentFile(loader, file)
+		require.Equal(t, 1, len(errs), file)
+		require.Contains(t, errs[0].Error(), expectedError, file)
+	}
+}
+
+func TestEvalContentSQLiteWAL(t *testing.T) {
+	siteRoot := t.TempDir()
+	writeFiles(t, siteRoot, map[string]string{
+		"content/site.yaml": `shop: {$sqlite: shop.db}`,
+	})
+
+	// Another tool keeps the database open in WAL mode, so its writes are
+	// still in shop.db-wal rather than shop.db.
+	db, err := sql.Open("sqlite", filepath.Join(siteRoot, "content", "shop.db"))
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	_, err = db.Exec(`
+PRAGMA journal_mode = WAL;
+PRAGMA wal_autocheckpoint = 0;
+CREATE TABLE products (name TEXT);
+INSERT INTO products VALUES ('hat');
+`)
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(siteRoot, "content", "shop.db-wal"))
+	require.NoError(t, err)
+
+	loader := processor.MakeFileLoader(os.DirFS(siteRoot), "content", processor.DefaultDecoders())
+	actual, errs := processor.EvalContentFile(loader, "site.yaml")
+	require.Equal(t, 0, len(errs))
+	require.Equal(t, map[string]any{
+		"shop": map[string]any{
+			"products": []any{map[string]any{"name": "hat"}},
+		},
+	}, actual)
+}
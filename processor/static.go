@@ -0,0 +1,92 @@
+package processor
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// StaticMount copies the files beneath Source to Target in the output.
+type StaticMount struct {
+	// Source is a directory relative to the config file.
+	Source string `yaml:"Source"`
+	// Target is a directory relative to OutputRoot. "" or "/" is the root of
+	// the output.
+	Target string `yaml:"Target"`
+	// Include optionally limits the mount to files matching these patterns.
+	// Exclude skips files matching these patterns. Both are relative to
+	// Source, and follow the same .gitignore rules as Config.Ignore.
+	Include []string `yaml:"Include"`
+	Exclude []string `yaml:"Exclude"`
+}
+
+// staticMount is a StaticMount ready to copy.
+type staticMount struct {
+	loader  FileLoader
+	target  string
+	include *IgnoreMatcher
+}
+
+// staticMounts returns the mounts of a config. Without a Static list,
+// StaticRoot is copied to the same-named directory of the output.
+func staticMounts(config Config) []StaticMount {
+	if len(config.Static) > 0 {
+		return config.Static
+	}
+	return []StaticMount{{config.StaticRoot, config.StaticRoot, nil, nil}}
+}
+
+// makeStaticMounts prepares the static mounts of a config. The static files
+// of themes are layered beneath any mount of StaticRoot.
+func makeStaticMounts(config Config, siteFS fs.FS, themeStatic []fs.FS) ([]staticMount, error) {
+	var mounts []staticMount
+	for i, mount := range staticMounts(config) {
+		if mount.Source == "" {
+			return nil, fmt.Errorf("Static[%d] must have a Source", i)
+		}
+
+		exclude, err := NewIgnoreMatcher(append(append([]string(nil), config.Ignore...), mount.Exclude...))
+		if err != nil {
+			return nil, fmt.Errorf("Static[%d] Exclude: %s", i, err.Error())
+		}
+
+		var include *IgnoreMatcher
+		if len(mount.Include) > 0 {
+			include, err = NewIgnoreMatcher(mount.Include)
+			if err != nil {
+				return nil, fmt.Errorf("Static[%d] Include: %s", i, err.Error())
+			}
+		}
+
+		var layers []fs.FS
+		if path.Clean(filepath.ToSlash(mount.Source)) == config.StaticRoot {
+			layers = themeStatic
+		}
+
+		mounts = append(mounts, staticMount{
+			layeredLoader(siteFS, mount.Source, layers, nil).WithIgnore(exclude),
+			strings.Trim(path.Clean("/"+filepath.ToSlash(mount.Target)), "/"),
+			include,
+		})
+	}
+	return mounts, nil
+}
+
+// isIncluded reports whether a file matches the Include patterns of the
+// mount, either itself or by one of its directories.
+func (m staticMount) isIncluded(relPath string) bool {
+	if m.include == nil {
+		return true
+	}
+	if m.include.Match(relPath, false) {
+		return true
+	}
+	for dir := path.Dir(relPath); dir != "."; dir = path.Dir(dir) {
+		if m.include.Match(dir, true) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package processor_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/treaster/incant/processor"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaticMounts(t *testing.T) {
+	siteFS := mapFS(map[string]string{
+		"config.yaml": `
+ContentRoot: content
+SiteContentFile: site.yaml
+MappingFile: mapping.yaml
+TemplatesRoot: templates
+TemplatesType: go/template
+OutputRoot: output
+Static:
+  - Source: theme/static
+    Target: /assets/
+    Exclude: ["*.scss"]
+  - Source: static
+    Target: assets
+    Include: ["css/", "*.png"]
+  - Source: root
+    Target: /
+`,
+		"content/site.yaml":    `{}`,
+		"content/mapping.yaml": `[{SingleOutput: index.html, Template: index.html, Selector: "jq:."}]`,
+		"templates/index.html": `home`,
+
+		"theme/static/css/site.css":  `theme`,
+		"theme/static/css/site.scss": `$x: 1;`,
+		"theme/static/js/site.js":    `theme js`,
+		"static/css/site.css":        `ours`,
+		"static/img/logo.png":        `png`,
+		"static/img/logo.psd":        `psd`,
+		"root/favicon.ico":           `ico`,
+		"root/CNAME":                 `example.com`,
+	})
+
+	result, err := processor.Build(context.Background(), processor.BuildOptions{
+		SiteFS:     siteFS,
+		ConfigPath: "config.yaml",
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string][]byte{
+		"index.html":          []byte("home"),
+		"assets/css/site.css": []byte("ours"),
+		"assets/js/site.js":   []byte("theme js"),
+		"assets/img/logo.png": []byte("png"),
+		"favicon.ico":         []byte("ico"),
+		"CNAME":               []byte("example.com"),
+	}, result.Files)
+}
@@ -0,0 +1,180 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// TabularOptions control how CSV and TSV files are decoded. They are given
+// per file, as a query string on the file path, e.g.
+// "file:prices.csv?delimiter=;&infer=true".
+type TabularOptions struct {
+	// Delimiter separates fields. Defaults to "," for .csv and tab for .tsv.
+	Delimiter rune
+	// Header means the first row names the columns, and each following row
+	// becomes a map keyed by those names. Without a header, each row becomes
+	// a list. Defaults to true.
+	Header bool
+	// Infer converts fields that look like booleans, numbers or dates into
+	// those types. Otherwise every field is a string.
+	Infer bool
+}
+
+// ParseTabularOptions reads TabularOptions from a query string, with the
+// keys "delimiter", "header" and "infer".
+func ParseTabularOptions(query string, defaultDelimiter rune) (TabularOptions, error) {
+	opts := TabularOptions{defaultDelimiter, true, false}
+	if query == "" {
+		return opts, nil
+	}
+
+	// url.ParseQuery rejects ";", which is a common delimiter, so the query
+	// is split by hand.
+	for _, pair := range strings.Split(query, "&") {
+		key, value, _ := strings.Cut(pair, "=")
+		value, err := url.QueryUnescape(value)
+		if err != nil {
+			return opts, fmt.Errorf("option %q: %s", key, err.Error())
+		}
+
+		switch key {
+		case "delimiter":
+			if value == `\t` || value == "tab" {
+				value = "\t"
+			}
+			if utf8.RuneCountInString(value) != 1 {
+				return opts, fmt.Errorf("delimiter must be a single character, got %q", value)
+			}
+			opts.Delimiter, _ = utf8.DecodeRuneInString(value)
+		case "header":
+			opts.Header, err = strconv.ParseBool(value)
+		case "infer":
+			opts.Infer, err = strconv.ParseBool(value)
+		default:
+			return opts, fmt.Errorf("unrecognized option %q", key)
+		}
+		if err != nil {
+			return opts, fmt.Errorf("option %q: %s", key, err.Error())
+		}
+	}
+	return opts, nil
+}
+
+// DecodeTabular decodes CSV-like data into a list of rows. A leading UTF-8
+// byte order mark, which spreadsheets often write, is ignored.
+func DecodeTabular(data []byte, opts TabularOptions) ([]any, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	var records [][]string
+	if opts.Delimiter == '\t' {
+		var err error
+		records, err = readTSV(data)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		reader := csv.NewReader(bytes.NewReader(data))
+		reader.Comma = opts.Delimiter
+		var err error
+		records, err = reader.ReadAll()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rows := []any{}
+	if !opts.Header {
+		for _, record := range records {
+			row := make([]any, len(record))
+			for i, field := range record {
+				row[i] = tabularValue(field, opts.Infer)
+			}
+			rows = append(rows, row)
+		}
+		return rows, nil
+	}
+
+	if len(records) == 0 {
+		return rows, nil
+	}
+	header := records[0]
+	for _, record := range records[1:] {
+		row := make(map[string]any, len(header))
+		for i, column := range header {
+			row[column] = tabularValue(record[i], opts.Infer)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// readTSV splits tab-separated data into records. Unlike CSV, TSV fields
+// aren't quoted, so quotes are kept as they are, and fields can't contain tabs
+// or newlines. Empty lines are skipped.
+func readTSV(data []byte) ([][]string, error) {
+	var records [][]string
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" {
+			continue
+		}
+		record := strings.Split(line, "\t")
+		if len(records) > 0 && len(record) != len(records[0]) {
+			return nil, fmt.Errorf("line %d has %d fields, expected %d", i+1, len(record), len(records[0]))
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func tabularValue(field string, infer bool) any {
+	if !infer {
+		return field
+	}
+
+	if b, err := strconv.ParseBool(field); err == nil && strings.ContainsAny(field, "eE") {
+		// Only true/false spellings, not "1" and "0", which are numbers.
+		return b
+	}
+	if i, err := strconv.ParseInt(field, 10, 64); err == nil {
+		return int(i)
+	}
+	if f, err := strconv.ParseFloat(field, 64); err == nil {
+		return f
+	}
+	for _, layout := range publishDateLayouts {
+		if t, err := time.Parse(layout, field); err == nil {
+			return t
+		}
+	}
+	return field
+}
+
+// assignDecoded stores a decoded value into output, which is a pointer as
+// passed to an unmarshal function. Values are converted to other output types
+// by way of JSON.
+func assignDecoded(value any, output any) error {
+	target := reflect.ValueOf(output)
+	if target.Kind() != reflect.Pointer || target.IsNil() {
+		return fmt.Errorf("output must be a non-nil pointer, got %T", output)
+	}
+
+	if target.Elem().Kind() == reflect.Interface {
+		target.Elem().Set(reflect.ValueOf(value))
+		return nil
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encoded, output)
+}
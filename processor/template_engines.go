@@ -0,0 +1,126 @@
+package processor
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// templateEngines holds one TemplateMgr per template engine in use. Each
+// template file is parsed and executed by exactly one engine: the engine set
+// by a mapping's TemplatesType, else the engine for the file's extension, else
+// the default engine.
+type templateEngines struct {
+	factories       map[string]func(TemplateMgrOptions) TemplateMgr
+	opts            TemplateMgrOptions
+	defaultType     string
+	typeByExtension map[string]string
+
+	// overrides maps template names to the engine set by their mappings.
+	overrides map[string]string
+	mgrs      map[string]TemplateMgr
+	names     map[string]bool
+
+	// page is the data of the template being executed, and pageType its
+	// engine, for shortcodes.
+	page     any
+	pageType string
+}
+
+func makeTemplateEngines(
+	factories map[string]func(TemplateMgrOptions) TemplateMgr,
+	opts TemplateMgrOptions,
+	defaultType string,
+	typeByExtension map[string]string,
+) (*templateEngines, error) {
+	_, hasType := factories[defaultType]
+	if !hasType {
+		return nil, fmt.Errorf("unrecognized TemplatesType %q", defaultType)
+	}
+	for ext, templatesType := range typeByExtension {
+		_, hasType := factories[templatesType]
+		if !hasType {
+			return nil, fmt.Errorf("unrecognized TemplatesType %q for extension %q", templatesType, ext)
+		}
+	}
+
+	return &templateEngines{
+		factories,
+		opts,
+		defaultType,
+		typeByExtension,
+		map[string]string{},
+		map[string]TemplateMgr{},
+		map[string]bool{},
+		nil,
+		"",
+	}, nil
+}
+
+// Override sets the engine for a template file. It must be called before the
+// template is parsed.
+func (te *templateEngines) Override(tmplName string, templatesType string) error {
+	_, hasType := te.factories[templatesType]
+	if !hasType {
+		return fmt.Errorf("unrecognized TemplatesType %q", templatesType)
+	}
+
+	existing, isOverridden := te.overrides[tmplName]
+	if isOverridden && existing != templatesType {
+		return fmt.Errorf("template %q is used with both TemplatesType %q and %q", tmplName, existing, templatesType)
+	}
+	te.overrides[tmplName] = templatesType
+	return nil
+}
+
+// TypeFor returns the engine for a template file. The longest matching
+// extension wins, so ".jet.html" takes precedence over ".html".
+func (te *templateEngines) TypeFor(tmplName string) string {
+	override, isOverridden := te.overrides[tmplName]
+	if isOverridden {
+		return override
+	}
+
+	exts := make([]string, 0, len(te.typeByExtension))
+	for ext := range te.typeByExtension {
+		exts = append(exts, ext)
+	}
+	sort.Slice(exts, func(i, j int) bool {
+		return len(exts[i]) > len(exts[j])
+	})
+
+	for _, ext := range exts {
+		if strings.HasSuffix(tmplName, ext) {
+			return te.typeByExtension[ext]
+		}
+	}
+	return te.defaultType
+}
+
+// MgrFor returns the TemplateMgr responsible for a template file, creating it
+// on first use.
+func (te *templateEngines) MgrFor(tmplName string) TemplateMgr {
+	templatesType := te.TypeFor(tmplName)
+	mgr, hasMgr := te.mgrs[templatesType]
+	if !hasMgr {
+		mgr = te.factories[templatesType](te.opts)
+		te.mgrs[templatesType] = mgr
+	}
+	return mgr
+}
+
+func (te *templateEngines) ParseOne(tmplName string, tmplBody []byte) error {
+	te.names[tmplName] = true
+	return te.MgrFor(tmplName).ParseOne(tmplName, tmplBody)
+}
+
+func (te *templateEngines) Execute(tmplName string, tmplData any, output io.Writer) error {
+	te.page = tmplData
+	te.pageType = te.TypeFor(tmplName)
+	defer func() {
+		te.page = nil
+		te.pageType = ""
+	}()
+	return te.MgrFor(tmplName).Execute(tmplName, tmplData, output)
+}
@@ -0,0 +1,91 @@
+package processor_test
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/treaster/incant/processor"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMixedTemplateEngines(t *testing.T) {
+	siteRoot := t.TempDir()
+	writeFiles(t, siteRoot, map[string]string{
+		"config.yaml": `
+ContentRoot: content
+SiteContentFile: site.yaml
+MappingFile: mapping.yaml
+TemplatesRoot: templates
+TemplatesType: go/template
+TemplatesTypeByExtension:
+  .jet.html: jet
+StaticRoot: static
+OutputRoot: output
+`,
+		"content/site.yaml": `name: incant`,
+		"content/mapping.yaml": `
+- SingleOutput: go.html
+  Template: page.html
+  Selector: jq:.
+- SingleOutput: jet.html
+  Template: page.jet.html
+  Selector: jq:.
+- SingleOutput: override.html
+  Template: other.tmpl
+  TemplatesType: jet
+  Selector: jq:.
+`,
+		"templates/page.html":     `go {{range .}}{{.name}}{{end}}`,
+		"templates/page.jet.html": `jet {{ range . }}{{ .name }}{{ end }}`,
+		"templates/other.tmpl":    `override {{ len(.) }}`,
+	})
+
+	buildSite(t, siteRoot, nil)
+
+	for outputName, expected := range map[string]string{
+		"go.html":       "go incant",
+		"jet.html":      "jet incant",
+		"override.html": "override 1",
+	} {
+		output, err := os.ReadFile(filepath.Join(siteRoot, "output", outputName))
+		require.NoError(t, err)
+		require.Equal(t, expected, string(output))
+	}
+}
+
+// buildSite runs every build step on the site in siteRoot, whose config file
+// must be config.yaml.
+func buildSite(t *testing.T, siteRoot string, overrideFn func(*processor.Config)) {
+	newSink := func(outputRoot string) (processor.OutputSink, error) {
+		return processor.NewDirSink(filepath.Join(siteRoot, outputRoot)), nil
+	}
+	buildSiteFS(t, os.DirFS(siteRoot), overrideFn, newSink)
+}
+
+func buildSiteFS(t *testing.T, siteFS fs.FS, overrideFn func(*processor.Config), newSink func(string) (processor.OutputSink, error)) {
+	factories := map[string]func(processor.TemplateMgrOptions) processor.TemplateMgr{
+		"go/template": processor.GoTemplateMgr,
+		"jet":         processor.JetTemplateMgr,
+	}
+	proc, hasError := processor.Load(context.Background(), processor.BuildOptions{
+		SiteFS:               siteFS,
+		ConfigPath:           "config.yaml",
+		OverrideConfig:       overrideFn,
+		TemplateMgrFactories: factories,
+		NewSink:              newSink,
+	})
+	require.False(t, hasError)
+
+	siteContent, hasError := proc.LoadSiteContent()
+	require.False(t, hasError)
+	mappings, hasError := proc.LoadMappings()
+	require.False(t, hasError)
+	require.False(t, proc.LoadTemplates())
+	require.False(t, proc.ProcessContent(mappings, siteContent))
+	require.False(t, proc.CopyStatic())
+	require.False(t, proc.CloseOutput())
+}
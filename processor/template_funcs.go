@@ -5,33 +5,93 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
-	"os"
+	"io/fs"
+	"path"
 	"time"
 
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/styles"
 	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
 	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer"
 	"github.com/yuin/goldmark/renderer/html"
 )
 
-func RenderMarkdown(input string) (string, error) {
-	md := goldmark.New(
-		goldmark.WithExtensions(
-			// Enables table, strikethrough, linkify, and tasklist markdown features.
-			extension.GFM,
-		),
-		goldmark.WithRendererOptions(
-			// Enables inline HTML in markdown content.
-			html.WithUnsafe(),
-		),
+// HighlightOptions configures server-side syntax highlighting of fenced code
+// blocks in Markdown. The language is taken from the fence info string, and
+// blocks may set options in braces after it, e.g.
+// ```go {linenos=true hl_lines=[2,"4-6"]}.
+type HighlightOptions struct {
+	// Style is the name of a chroma style, e.g. "github". Highlighting is
+	// disabled if it is empty.
+	Style string
+	// LineNumbers numbers the lines of every block.
+	LineNumbers bool
+	// Classes emits CSS classes instead of inline styles. The classes are
+	// defined by HighlightStylesheet.
+	Classes bool
+}
+
+const defaultHighlightStylesheet = "highlight.css"
+
+// newMarkdown returns a Markdown renderer. Unless allowHTML is set, raw HTML in
+// the Markdown is omitted and links with dangerous schemes, like javascript:,
+// are dropped, so that untrusted content can't inject markup.
+func newMarkdown(highlight HighlightOptions, allowHTML bool) goldmark.Markdown {
+	extensions := []goldmark.Extender{
+		// Enables table, strikethrough, linkify, and tasklist markdown features.
+		extension.GFM,
+	}
+	if highlight.Style != "" {
+		extensions = append(extensions, highlighting.NewHighlighting(
+			highlighting.WithStyle(highlight.Style),
+			highlighting.WithFormatOptions(
+				chromahtml.WithClasses(highlight.Classes),
+				chromahtml.WithLineNumbers(highlight.LineNumbers),
+			),
+		))
+	}
+
+	var rendererOptions []renderer.Option
+	if allowHTML {
+		// Enables inline HTML in markdown content.
+		rendererOptions = append(rendererOptions, html.WithUnsafe())
+	}
+
+	return goldmark.New(
+		goldmark.WithExtensions(extensions...),
+		goldmark.WithRendererOptions(rendererOptions...),
 	)
+}
+
+// HighlightStylesheet returns the CSS for a chroma style, for use with
+// HighlightOptions.Classes.
+func HighlightStylesheet(style string) (string, error) {
+	chromaStyle, hasStyle := styles.Registry[style]
+	if !hasStyle {
+		return "", fmt.Errorf("unrecognized highlight style %q", style)
+	}
+
+	var buf bytes.Buffer
+	err := chromahtml.New(chromahtml.WithClasses(true)).WriteCSS(&buf, chromaStyle)
+	return buf.String(), err
+}
+
+var defaultMarkdown = newMarkdown(HighlightOptions{}, true)
+
+func RenderMarkdown(input string) (string, error) {
+	return renderMarkdownWith(defaultMarkdown, input)
+}
 
+func renderMarkdownWith(md goldmark.Markdown, input string) (string, error) {
 	var buf bytes.Buffer
 	err := md.Convert([]byte(input), &buf)
 	return buf.String(), err
 }
 
-func DataUrl(assetType string, assetPath string) string {
-	data, err := os.ReadFile(assetPath)
+func DataUrl(fsys fs.FS, assetType string, assetPath string) string {
+	data, err := fs.ReadFile(fsys, path.Clean(assetPath))
 	if err != nil {
 		panic(fmt.Sprintf("error reading source asset %s: %s", assetPath, err.Error()))
 	}
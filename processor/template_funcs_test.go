@@ -0,0 +1,69 @@
+package processor_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/treaster/incant/processor"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHighlightCodeBlocks(t *testing.T) {
+	siteRoot := t.TempDir()
+	writeFiles(t, siteRoot, map[string]string{
+		"config.yaml": `
+ContentRoot: content
+SiteContentFile: site.yaml
+MappingFile: mapping.yaml
+TemplatesRoot: templates
+TemplatesType: go/template
+StaticRoot: static
+OutputRoot: output
+HighlightStyle: github
+`,
+		"content/site.yaml": "body: |\n" +
+			"  ```go {hl_lines=[2]}\n" +
+			"  func main() {\n" +
+			"      return\n" +
+			"  }\n" +
+			"  ```\n",
+		"content/mapping.yaml": `
+- SingleOutput: page.html
+  Template: page.html
+  Selector: jq:.body
+`,
+		"templates/page.html": `{{range .}}{{RenderMarkdown .}}{{end}}`,
+	})
+
+	readOutput := func(name string) string {
+		output, err := os.ReadFile(filepath.Join(siteRoot, "output", name))
+		require.NoError(t, err)
+		return string(output)
+	}
+
+	buildSite(t, siteRoot, nil)
+	inline := readOutput("page.html")
+	require.Contains(t, inline, `<span style="color:#000;font-weight:bold">func</span>`)
+	require.Contains(t, inline, `<span style="display:flex; background-color:#e5e5e5">`)
+	_, err := os.Stat(filepath.Join(siteRoot, "output", "highlight.css"))
+	require.True(t, os.IsNotExist(err))
+
+	buildSite(t, siteRoot, func(config *processor.Config) {
+		config.HighlightClasses = true
+		config.HighlightLineNumbers = true
+	})
+	classed := readOutput("page.html")
+	require.Contains(t, classed, `<span class="kd">func</span>`)
+	require.Contains(t, classed, `<span class="line hl">`)
+	require.Equal(t, 3, strings.Count(classed, `<span class="ln">`))
+
+	stylesheet, err := processor.HighlightStylesheet("github")
+	require.NoError(t, err)
+	require.Equal(t, stylesheet, readOutput("highlight.css"))
+
+	_, err = processor.HighlightStylesheet("no-such-style")
+	require.Error(t, err)
+}
@@ -0,0 +1,463 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/fs"
+	"math"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// HTML, HTMLAttr and URL mark function results as trusted markup, which
+// auto-escaping engines output verbatim. Custom functions may return them too.
+type HTML string
+type HTMLAttr string
+type URL string
+
+// StdTemplateFuncs returns the functions available to templates of every
+// engine. Load adds any custom functions on top of these, and passes the
+// result to the TemplateMgr factories as TemplateMgrOptions.Funcs.
+func StdTemplateFuncs(dataFS fs.FS) map[string]any {
+	return map[string]any{
+		"RenderMarkdown": func(input string) (HTML, error) {
+			rendered, err := RenderMarkdown(input)
+			return HTML(rendered), err
+		},
+		"DataUrl": func(assetType string, assetPath string) string {
+			return DataUrl(dataFS, assetType, assetPath)
+		},
+		"NowLocal":  NowLocal,
+		"NowUTC":    NowUTC,
+		"NamedArgs": NamedArgs,
+		"Sprintf": func(format string, a ...any) string {
+			return fmt.Sprintf(format, a...)
+		},
+
+		// Integer math.
+		"Add":  func(a int, b int) int { return a + b },
+		"Sub":  func(a int, b int) int { return a - b },
+		"Mult": func(a int, b int) int { return a * b },
+		"Div":  func(a int, b int) int { return a / b },
+
+		// Float math. Arguments may be any number.
+		"AddF":  floatOp(func(a float64, b float64) float64 { return a + b }),
+		"SubF":  floatOp(func(a float64, b float64) float64 { return a - b }),
+		"MultF": floatOp(func(a float64, b float64) float64 { return a * b }),
+		"DivF":  floatOp(func(a float64, b float64) float64 { return a / b }),
+		"Round": Round,
+		"Floor": func(x any) (float64, error) {
+			f, err := toFloat(x)
+			return math.Floor(f), err
+		},
+		"Ceil": func(x any) (float64, error) {
+			f, err := toFloat(x)
+			return math.Ceil(f), err
+		},
+
+		// Strings.
+		"Upper":     strings.ToUpper,
+		"Lower":     strings.ToLower,
+		"Title":     Title,
+		"Trim":      strings.TrimSpace,
+		"Replace":   func(s string, old string, new string) string { return strings.ReplaceAll(s, old, new) },
+		"Contains":  strings.Contains,
+		"HasPrefix": strings.HasPrefix,
+		"HasSuffix": strings.HasSuffix,
+		"Split":     strings.Split,
+		"Join":      Join,
+		"Slugify":   Slugify,
+		"Truncate":  Truncate,
+		"Excerpt":   Excerpt,
+
+		// Lists.
+		"SortBy":  SortBy,
+		"Reverse": Reverse,
+		"First":   First,
+		"Where":   Where,
+		"Filter":  Filter,
+		"GroupBy": GroupBy,
+
+		// Dates.
+		"ParseDate":  parsePublishDate,
+		"FormatDate": FormatDate,
+
+		// Encoding and escaping.
+		"ToJSON":       ToJSON,
+		"EscapeHTML":   html.EscapeString,
+		"EscapeURL":    url.QueryEscape,
+		"SafeHTML":     func(s string) HTML { return HTML(s) },
+		"SafeHTMLAttr": func(s string) HTMLAttr { return HTMLAttr(s) },
+		"SafeURL":      func(s string) URL { return URL(s) },
+	}
+}
+
+// templateFuncs returns the function registry for a TemplateMgr, falling back
+// to the standard functions when none were given.
+func templateFuncs(opts TemplateMgrOptions) map[string]any {
+	if opts.Funcs != nil {
+		return opts.Funcs
+	}
+	if opts.DataFS == nil {
+		return StdTemplateFuncs(os.DirFS("."))
+	}
+	return StdTemplateFuncs(opts.DataFS)
+}
+
+// adaptMarkupFuncs returns a copy of funcs where each function whose first
+// result is a markup type returns the engine's equivalent type instead.
+// converters maps markup types to functions such as
+// func(string) template.HTML.
+func adaptMarkupFuncs(funcs map[string]any, converters map[reflect.Type]any) map[string]any {
+	adapted := make(map[string]any, len(funcs))
+	for name, fn := range funcs {
+		adapted[name] = fn
+
+		fnValue := reflect.ValueOf(fn)
+		fnType := fnValue.Type()
+		if fnType.Kind() != reflect.Func || fnType.NumOut() == 0 {
+			continue
+		}
+		converter, isMarkup := converters[fnType.Out(0)]
+		if !isMarkup {
+			continue
+		}
+		converterValue := reflect.ValueOf(converter)
+
+		ins := make([]reflect.Type, fnType.NumIn())
+		for i := range ins {
+			ins[i] = fnType.In(i)
+		}
+		outs := make([]reflect.Type, fnType.NumOut())
+		for i := range outs {
+			outs[i] = fnType.Out(i)
+		}
+		outs[0] = converterValue.Type().Out(0)
+
+		newType := reflect.FuncOf(ins, outs, fnType.IsVariadic())
+		adapted[name] = reflect.MakeFunc(newType, func(args []reflect.Value) []reflect.Value {
+			var results []reflect.Value
+			if fnType.IsVariadic() {
+				results = fnValue.CallSlice(args)
+			} else {
+				results = fnValue.Call(args)
+			}
+			results[0] = converterValue.Call([]reflect.Value{reflect.ValueOf(results[0].String())})[0]
+			return results
+		}).Interface()
+	}
+	return adapted
+}
+
+func toFloat(x any) (float64, error) {
+	v := reflect.ValueOf(x)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	default:
+		return 0, fmt.Errorf("expected a number, got %T", x)
+	}
+}
+
+func floatOp(op func(float64, float64) float64) func(any, any) (float64, error) {
+	return func(a any, b any) (float64, error) {
+		af, err := toFloat(a)
+		if err != nil {
+			return 0, err
+		}
+		bf, err := toFloat(b)
+		if err != nil {
+			return 0, err
+		}
+		return op(af, bf), nil
+	}
+}
+
+// Round rounds x to the given number of decimal places.
+func Round(x any, places int) (float64, error) {
+	f, err := toFloat(x)
+	if err != nil {
+		return 0, err
+	}
+	scale := math.Pow(10, float64(places))
+	return math.Round(f*scale) / scale, nil
+}
+
+// Title upper-cases the first letter of each word.
+func Title(s string) string {
+	isWordStart := true
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			isWordStart = true
+			return r
+		}
+		if isWordStart {
+			isWordStart = false
+			return unicode.ToUpper(r)
+		}
+		return r
+	}, s)
+}
+
+// Join joins the elements of a list, formatted with %v.
+func Join(list any, sep string) (string, error) {
+	items, err := toList(list)
+	if err != nil {
+		return "", err
+	}
+	parts := make([]string, len(items))
+	for i, item := range items {
+		parts[i] = fmt.Sprint(item)
+	}
+	return strings.Join(parts, sep), nil
+}
+
+var slugInvalid = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Slugify converts s into lowercase words separated by hyphens, suitable for
+// use in URLs.
+func Slugify(s string) string {
+	s = strings.ToLower(s)
+	return strings.Trim(slugInvalid.ReplaceAllString(s, "-"), "-")
+}
+
+// Truncate shortens s to at most maxRunes runes, ending it with an ellipsis if
+// anything was removed.
+func Truncate(s string, maxRunes int) string {
+	if utf8.RuneCountInString(s) <= maxRunes {
+		return s
+	}
+	runes := []rune(s)
+	return strings.TrimRightFunc(string(runes[:maxRunes]), unicode.IsSpace) + "…"
+}
+
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// Excerpt returns the first maxWords words of s, with any HTML tags removed,
+// ending with an ellipsis if anything was removed. It is meant for summaries
+// of rendered Markdown.
+func Excerpt(s string, maxWords int) string {
+	text := html.UnescapeString(htmlTag.ReplaceAllString(s, " "))
+	words := strings.Fields(text)
+	if len(words) <= maxWords {
+		return strings.Join(words, " ")
+	}
+	return strings.Join(words[:maxWords], " ") + "…"
+}
+
+func toList(list any) ([]any, error) {
+	if list == nil {
+		return nil, nil
+	}
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("expected a list, got %T", list)
+	}
+	items := make([]any, v.Len())
+	for i := range items {
+		items[i] = v.Index(i).Interface()
+	}
+	return items, nil
+}
+
+// fieldOf reads a dotted path of map keys or struct fields from item.
+func fieldOf(item any, key string) (any, bool) {
+	current := reflect.ValueOf(item)
+	for _, segment := range strings.Split(key, ".") {
+		for current.Kind() == reflect.Pointer || current.Kind() == reflect.Interface {
+			if current.IsNil() {
+				return nil, false
+			}
+			current = current.Elem()
+		}
+
+		switch current.Kind() {
+		case reflect.Map:
+			if current.Type().Key().Kind() != reflect.String {
+				return nil, false
+			}
+			current = current.MapIndex(reflect.ValueOf(segment).Convert(current.Type().Key()))
+		case reflect.Struct:
+			current = current.FieldByName(segment)
+		default:
+			return nil, false
+		}
+		if !current.IsValid() {
+			return nil, false
+		}
+	}
+	return current.Interface(), true
+}
+
+// compareValues orders numbers numerically, dates chronologically, and
+// everything else by its formatted string.
+func compareValues(a any, b any) int {
+	af, aErr := toFloat(a)
+	bf, bErr := toFloat(b)
+	if aErr == nil && bErr == nil {
+		switch {
+		case af < bf:
+			return -1
+		case af > bf:
+			return 1
+		default:
+			return 0
+		}
+	}
+
+	at, aIsTime := a.(time.Time)
+	bt, bIsTime := b.(time.Time)
+	if aIsTime && bIsTime {
+		return at.Compare(bt)
+	}
+
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// SortBy returns a copy of list sorted by the given field, in ascending order.
+// An empty key sorts by the elements themselves.
+func SortBy(list any, key string) ([]any, error) {
+	items, err := toList(list)
+	if err != nil {
+		return nil, err
+	}
+	sortKey := func(item any) any {
+		if key == "" {
+			return item
+		}
+		value, _ := fieldOf(item, key)
+		return value
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return compareValues(sortKey(items[i]), sortKey(items[j])) < 0
+	})
+	return items, nil
+}
+
+func Reverse(list any) ([]any, error) {
+	items, err := toList(list)
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+		items[i], items[j] = items[j], items[i]
+	}
+	return items, nil
+}
+
+// First returns at most the first n elements of list.
+func First(list any, n int) ([]any, error) {
+	items, err := toList(list)
+	if err != nil {
+		return nil, err
+	}
+	if n < len(items) {
+		items = items[:n]
+	}
+	return items, nil
+}
+
+// Where returns the elements of list whose field equals value. A field
+// holding a list matches if any of its elements equals value.
+func Where(list any, key string, value any) ([]any, error) {
+	items, err := toList(list)
+	if err != nil {
+		return nil, err
+	}
+	var matches []any
+	for _, item := range items {
+		field, hasField := fieldOf(item, key)
+		if !hasField {
+			continue
+		}
+		candidates, err := toList(field)
+		if err != nil {
+			candidates = []any{field}
+		}
+		for _, candidate := range candidates {
+			if compareValues(candidate, value) == 0 {
+				matches = append(matches, item)
+				break
+			}
+		}
+	}
+	return matches, nil
+}
+
+// Filter returns the elements of list whose field is set to a non-zero value.
+func Filter(list any, key string) ([]any, error) {
+	items, err := toList(list)
+	if err != nil {
+		return nil, err
+	}
+	var matches []any
+	for _, item := range items {
+		field, hasField := fieldOf(item, key)
+		if hasField && field != nil && !reflect.ValueOf(field).IsZero() {
+			matches = append(matches, item)
+		}
+	}
+	return matches, nil
+}
+
+type Group struct {
+	Key   any
+	Items []any
+}
+
+// GroupBy splits list into groups of elements with the same field value. The
+// groups are in order of first appearance.
+func GroupBy(list any, key string) ([]Group, error) {
+	items, err := toList(list)
+	if err != nil {
+		return nil, err
+	}
+	var groups []Group
+	for _, item := range items {
+		field, _ := fieldOf(item, key)
+		found := false
+		for i := range groups {
+			if compareValues(groups[i].Key, field) == 0 {
+				groups[i].Items = append(groups[i].Items, item)
+				found = true
+				break
+			}
+		}
+		if !found {
+			groups = append(groups, Group{field, []any{item}})
+		}
+	}
+	return groups, nil
+}
+
+// FormatDate formats a time.Time, or a date string in any format accepted by
+// ParseDate. The layout may be a Go layout, or the name of one of the time
+// package constants, e.g. "RFC3339" or "DateOnly".
+func FormatDate(layout string, date any) (string, error) {
+	parsed, err := parsePublishDate(date)
+	if err != nil {
+		return "", err
+	}
+	finalLayout, hasLayout := timeLayouts[layout]
+	if !hasLayout {
+		finalLayout = layout
+	}
+	return parsed.Format(finalLayout), nil
+}
+
+func ToJSON(value any) (string, error) {
+	encoded, err := json.Marshal(value)
+	return string(encoded), err
+}
@@ -0,0 +1,86 @@
+package processor_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/treaster/incant/processor"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStdTemplateFuncs(t *testing.T) {
+	require.Equal(t, "hello-world-2", processor.Slugify("  Hello, World! 2 "))
+	require.Equal(t, "Hello World", processor.Title("hello world"))
+	require.Equal(t, "abc…", processor.Truncate("abc def", 4))
+	require.Equal(t, "abc def", processor.Truncate("abc def", 7))
+	require.Equal(t, "one two…", processor.Excerpt("<p>one <em>two</em> three</p>", 2))
+
+	rounded, err := processor.Round(2.345, 2)
+	require.NoError(t, err)
+	require.Equal(t, 2.35, rounded)
+
+	recipes := []any{
+		map[string]any{"name": "cake", "course": "dessert", "time": 60, "tags": []any{"sweet"}},
+		map[string]any{"name": "soup", "course": "main", "time": 30, "tags": []any{"warm"}},
+		map[string]any{"name": "pie", "course": "dessert", "time": 45, "tags": []any{"sweet", "warm"}},
+	}
+
+	names := func(items []any) []string {
+		var result []string
+		for _, item := range items {
+			result = append(result, item.(map[string]any)["name"].(string))
+		}
+		return result
+	}
+
+	sorted, err := processor.SortBy(recipes, "time")
+	require.NoError(t, err)
+	require.Equal(t, []string{"soup", "pie", "cake"}, names(sorted))
+
+	warm, err := processor.Where(recipes, "tags", "warm")
+	require.NoError(t, err)
+	require.Equal(t, []string{"soup", "pie"}, names(warm))
+
+	groups, err := processor.GroupBy(recipes, "course")
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+	require.Equal(t, "dessert", groups[0].Key)
+	require.Equal(t, []string{"cake", "pie"}, names(groups[0].Items))
+	require.Equal(t, []string{"soup"}, names(groups[1].Items))
+
+	formatted, err := processor.FormatDate("Jan 2, 2006", "2024-03-05")
+	require.NoError(t, err)
+	require.Equal(t, "Mar 5, 2024", formatted)
+}
+
+func TestTemplateFuncsSharedByEngines(t *testing.T) {
+	funcs := processor.StdTemplateFuncs(nil)
+	funcs["Shout"] = func(s string) string { return s + "!" }
+	funcs["Bold"] = func(s string) processor.HTML { return processor.HTML("<b>" + s + "</b>") }
+
+	data := map[string]any{"name": "a<b"}
+	for _, tc := range []struct {
+		factory  func(processor.TemplateMgrOptions) processor.TemplateMgr
+		body     string
+		expected string
+	}{
+		{processor.GoTemplateMgr, `{{Shout .name}} {{Bold "x"}} {{Slugify "Hi There"}}`, "a<b! <b>x</b> hi-there"},
+		{processor.GoHtmlTemplateMgr, `{{Shout .name}} {{Bold "x"}} {{Slugify "Hi There"}}`, "a&lt;b! <b>x</b> hi-there"},
+		{processor.JetTemplateMgr, `{{ Shout(.name) }} {{ Bold("x") }} {{ Slugify("Hi There") }}`, "a<b! <b>x</b> hi-there"},
+	} {
+		for _, autoEscape := range []bool{false, true} {
+			mgr := tc.factory(processor.TemplateMgrOptions{AutoEscape: autoEscape, Funcs: funcs})
+			require.NoError(t, mgr.ParseOne("page.html", []byte(tc.body)))
+
+			var output bytes.Buffer
+			require.NoError(t, mgr.Execute("page.html", data, &output))
+
+			expected := tc.expected
+			if autoEscape {
+				expected = "a&lt;b! <b>x</b> hi-there"
+			}
+			require.Equal(t, expected, output.String())
+		}
+	}
+}
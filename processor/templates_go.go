@@ -3,47 +3,164 @@ package processor
 import (
 	"fmt"
 	"io"
-	"path/filepath"
+	"strings"
 	"text/template"
+	"text/template/parse"
 )
 
-func GoTemplateMgr(dataUrlRoot string) TemplateMgr {
+func GoTemplateMgr(opts TemplateMgrOptions) TemplateMgr {
+	if opts.AutoEscape {
+		return GoHtmlTemplateMgr(opts)
+	}
+
 	tmpl := template.
 		New("incant").
-		Funcs(template.FuncMap{
-			"RenderMarkdown": RenderMarkdown,
-			"DataUrl": func(assetType string, assetPath string) string {
-				fullPath := filepath.Join(dataUrlRoot, assetPath)
-				return DataUrl(assetType, fullPath)
-			},
-			"Add":       func(a int, b int) int { return a + b },
-			"Sub":       func(a int, b int) int { return a - b },
-			"Mult":      func(a int, b int) int { return a * b },
-			"Div":       func(a int, b int) int { return a / b },
-			"NowLocal":  NowLocal,
-			"NowUTC":    NowUTC,
-			"NamedArgs": NamedArgs,
-		}).
+		Funcs(template.FuncMap(templateFuncs(opts))).
 		Option("missingkey=error")
 
-	return &goTemplateMgr{tmpl}
+	return newGoTemplateMgr(tmpl, func(t *template.Template) *parse.Tree {
+		if t == nil {
+			return nil
+		}
+		return t.Tree
+	})
+}
+
+// goTemplate is the API shared by text/template and html/template.
+type goTemplate[T any] interface {
+	Name() string
+	New(name string) T
+	Parse(text string) (T, error)
+	Clone() (T, error)
+	Lookup(name string) T
+	Templates() []T
+	Execute(wr io.Writer, data any) error
+}
+
+// goTemplateMgr keeps layouts and partials in a shared base template, and
+// gives every other template (a "page") its own clone of that base. Pages can
+// therefore {{define}} the blocks of a layout without colliding with the
+// definitions of other pages.
+type goTemplateMgr[T goTemplate[T]] struct {
+	base T
+	// treeOf returns the parse tree of a template, or nil for a nil template.
+	treeOf func(T) *parse.Tree
+	// definedIn maps the names of templates {{define}}d in shared files to
+	// the file which defined them.
+	definedIn map[string]string
+
+	pageBodies map[string][]byte
+	pages      map[string]T
+	// pageDefined holds the names of the templates defined by each page,
+	// including the shared blocks it overrides.
+	pageDefined map[string]map[string]bool
+}
+
+func newGoTemplateMgr[T goTemplate[T]](base T, treeOf func(T) *parse.Tree) *goTemplateMgr[T] {
+	return &goTemplateMgr[T]{
+		base,
+		treeOf,
+		map[string]string{},
+		map[string][]byte{},
+		map[string]T{},
+		map[string]map[string]bool{},
+	}
 }
 
-type goTemplateMgr struct {
-	tmpl *template.Template
+// IsSharedTemplate reports whether a template file belongs in the shared base
+// of go/template pages. Shared files live in a top-level directory whose name
+// starts with an underscore, such as _layouts/ or _partials/.
+func IsSharedTemplate(tmplName string) bool {
+	return strings.HasPrefix(tmplName, "_") && strings.Contains(tmplName, "/")
 }
 
-func (tm *goTemplateMgr) ParseOne(tmplName string, tmplBody []byte) error {
-	_, err := tm.tmpl.New(tmplName).Parse(string(tmplBody))
+func (tm *goTemplateMgr[T]) ParseOne(tmplName string, tmplBody []byte) error {
+	if !IsSharedTemplate(tmplName) {
+		tm.pageBodies[tmplName] = tmplBody
+		_, err := tm.pageSet(tmplName)
+		return err
+	}
+
+	existing := map[string]bool{}
+	for _, t := range tm.base.Templates() {
+		existing[t.Name()] = true
+	}
+
+	_, err := tm.base.New(tmplName).Parse(string(tmplBody))
 	if err != nil {
 		return fmt.Errorf("error parsing template %q: %s", tmplName, err.Error())
 	}
+
+	for _, t := range tm.base.Templates() {
+		if !existing[t.Name()] && t.Name() != tmplName {
+			tm.definedIn[t.Name()] = tmplName
+		}
+	}
+
+	// Pages must be re-cloned to see the new shared templates.
+	tm.pages = map[string]T{}
 	return nil
 }
 
-func (tm *goTemplateMgr) Execute(tmplName string, tmplData any, output io.Writer) error {
-	tmpl := tm.tmpl.Lookup(tmplName)
-	if tmpl == nil {
+// pageSet returns the template set for executing tmplName: a clone of the
+// shared base, plus the page itself.
+func (tm *goTemplateMgr[T]) pageSet(tmplName string) (T, error) {
+	set, isCached := tm.pages[tmplName]
+	if isCached {
+		return set, nil
+	}
+
+	set, err := tm.base.Clone()
+	if err != nil {
+		return set, err
+	}
+
+	body, isPage := tm.pageBodies[tmplName]
+	if isPage {
+		sharedTrees := map[string]*parse.Tree{}
+		for _, t := range set.Templates() {
+			sharedTrees[t.Name()] = tm.treeOf(t)
+		}
+
+		_, err = set.New(tmplName).Parse(string(body))
+		if err != nil {
+			return set, fmt.Errorf("error parsing template %q: %s", tmplName, err.Error())
+		}
+
+		defined := map[string]bool{}
+		for _, t := range set.Templates() {
+			if tm.treeOf(t) != sharedTrees[t.Name()] {
+				defined[t.Name()] = true
+			}
+		}
+		tm.pageDefined[tmplName] = defined
+	}
+
+	tm.pages[tmplName] = set
+	return set, nil
+}
+
+// fileOf returns the template file that defines name, when executing page
+// pageName.
+func (tm *goTemplateMgr[T]) fileOf(pageName string, name string) string {
+	if tm.pageDefined[pageName][name] {
+		return pageName
+	}
+	definingFile, isDefined := tm.definedIn[name]
+	if isDefined {
+		return definingFile
+	}
+	return name
+}
+
+func (tm *goTemplateMgr[T]) Execute(tmplName string, tmplData any, output io.Writer) error {
+	set, err := tm.pageSet(tmplName)
+	if err != nil {
+		return err
+	}
+
+	tmpl := set.Lookup(tmplName)
+	if tm.treeOf(tmpl) == nil {
 		panic(fmt.Sprintf("error: template %q not found", tmplName))
 	}
 
@@ -0,0 +1,70 @@
+package processor_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/treaster/incant/processor"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoTemplateLayouts(t *testing.T) {
+	mgr := processor.GoTemplateMgr(processor.TemplateMgrOptions{})
+
+	// Pages may be parsed before the layouts they use.
+	templates := []struct {
+		name string
+		body string
+	}{
+		{"about.html", `{{template "_layouts/base.html" .}}{{define "content"}}About {{.name}}{{end}}`},
+		{"home.html", `{{template "_layouts/base.html" .}}{{define "content"}}Home{{template "footer" .}}{{end}}`},
+		{"plain.html", `{{template "_layouts/base.html" .}}`},
+		{"_layouts/base.html", `<main>{{block "content" .}}default{{end}}</main>`},
+		{"_partials/footer.html", `{{define "footer"}} by {{.name}}{{end}}`},
+	}
+	for _, tmpl := range templates {
+		require.NoError(t, mgr.ParseOne(tmpl.name, []byte(tmpl.body)))
+	}
+
+	execute := func(name string) string {
+		var output bytes.Buffer
+		err := mgr.Execute(name, map[string]any{"name": "incant"}, &output)
+		require.NoError(t, err)
+		return output.String()
+	}
+
+	require.Equal(t, "<main>About incant</main>", execute("about.html"))
+	require.Equal(t, "<main>Home by incant</main>", execute("home.html"))
+	require.Equal(t, "<main>default</main>", execute("plain.html"))
+}
+
+func TestGoHtmlTemplateEscaping(t *testing.T) {
+	for _, mgr := range []processor.TemplateMgr{
+		processor.GoHtmlTemplateMgr(processor.TemplateMgrOptions{}),
+		processor.GoTemplateMgr(processor.TemplateMgrOptions{AutoEscape: true}),
+	} {
+		require.NoError(t, mgr.ParseOne("page.html", []byte(`<p>{{.comment}}</p>{{RenderMarkdown .body}}`)))
+
+		var output bytes.Buffer
+		err := mgr.Execute("page.html", map[string]any{
+			"comment": `<script>alert("hi")</script>`,
+			"body":    "*hello*",
+		}, &output)
+		require.NoError(t, err)
+		require.Equal(t, "<p>&lt;script&gt;alert(&#34;hi&#34;)&lt;/script&gt;</p><p><em>hello</em></p>\n", output.String())
+	}
+}
+
+func TestJetTemplateEscaping(t *testing.T) {
+	mgr := processor.JetTemplateMgr(processor.TemplateMgrOptions{AutoEscape: true})
+	require.NoError(t, mgr.ParseOne("page.html", []byte(`<p>{{ .comment }}</p>{{ RenderMarkdown(.body) }}`)))
+
+	var output bytes.Buffer
+	err := mgr.Execute("page.html", map[string]any{
+		"comment": `<b>`,
+		"body":    "*hello*",
+	}, &output)
+	require.NoError(t, err)
+	require.Equal(t, "<p>&lt;b&gt;</p><p><em>hello</em></p>\n", output.String())
+}
@@ -0,0 +1,31 @@
+package processor
+
+import (
+	"html/template"
+	"reflect"
+	"text/template/parse"
+)
+
+// GoHtmlTemplateMgr is like GoTemplateMgr, but uses html/template, which
+// escapes output according to its context in the HTML document. Functions
+// which produce markup, like RenderMarkdown, return template.HTML so that
+// their output is not escaped.
+func GoHtmlTemplateMgr(opts TemplateMgrOptions) TemplateMgr {
+	funcs := adaptMarkupFuncs(templateFuncs(opts), map[reflect.Type]any{
+		reflect.TypeOf(HTML("")):     func(s string) template.HTML { return template.HTML(s) },
+		reflect.TypeOf(HTMLAttr("")): func(s string) template.HTMLAttr { return template.HTMLAttr(s) },
+		reflect.TypeOf(URL("")):      func(s string) template.URL { return template.URL(s) },
+	})
+
+	tmpl := template.
+		New("incant").
+		Funcs(template.FuncMap(funcs)).
+		Option("missingkey=error")
+
+	return newGoTemplateMgr(tmpl, func(t *template.Template) *parse.Tree {
+		if t == nil {
+			return nil
+		}
+		return t.Tree
+	})
+}
@@ -4,7 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"path/filepath"
+	"reflect"
 	"strings"
 
 	"github.com/CloudyKit/jet/v6"
@@ -32,22 +32,35 @@ func (cl customLoader) Exists(name string) bool {
 	return hasName
 }
 
-func JetTemplateMgr(dataUrlRoot string) TemplateMgr {
+func JetTemplateMgr(opts TemplateMgrOptions) TemplateMgr {
 	loader := customLoader{}
+
+	funcs := templateFuncs(opts)
+
+	var setOptions []jet.Option
+	if opts.AutoEscape {
+		// Markup bypasses the escaping.
+		writeRaw := func(s string) jet.RendererFunc {
+			return func(r *jet.Runtime) {
+				r.Writer.Write([]byte(s))
+			}
+		}
+		funcs = adaptMarkupFuncs(funcs, map[reflect.Type]any{
+			reflect.TypeOf(HTML("")):     writeRaw,
+			reflect.TypeOf(HTMLAttr("")): writeRaw,
+			reflect.TypeOf(URL("")):      writeRaw,
+		})
+	} else {
+		setOptions = append(setOptions, jet.WithSafeWriter(nil))
+	}
+
 	set := jet.NewSet(
 		loader,
-		jet.WithSafeWriter(nil),
-	).
-		AddGlobal("RenderMarkdown", RenderMarkdown).
-		AddGlobal("DataUrl", func(assetType string, assetPath string) string {
-			fullPath := filepath.Join(dataUrlRoot, assetPath)
-			return DataUrl(assetType, fullPath)
-		}).
-		AddGlobal("NowLocal", NowLocal).
-		AddGlobal("NowUTC", NowUTC).
-		AddGlobal("Sprintf", func(format string, a ...any) string {
-			return fmt.Sprintf(format, a...)
-		})
+		setOptions...,
+	)
+	for name, fn := range funcs {
+		set.AddGlobal(name, fn)
+	}
 
 	return &jetTemplateMgr{
 		loader,
@@ -0,0 +1,142 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+)
+
+// ThemeManifest is the base name of a theme's optional manifest file, e.g.
+// theme.yaml. It may be in any content format.
+const ThemeManifest = "theme"
+
+// Theme describes the layout of a theme. Every field is optional.
+type Theme struct {
+	// The directories of the theme, relative to the theme. They default to
+	// content, templates and static.
+	ContentRoot   string `yaml:"ContentRoot"`
+	TemplatesRoot string `yaml:"TemplatesRoot"`
+	StaticRoot    string `yaml:"StaticRoot"`
+
+	// ContentSchema optionally names a JSON Schema file, relative to the
+	// theme's ContentRoot, which the site content must satisfy to be used
+	// with the theme. It is the theme's content contract.
+	ContentSchema string `yaml:"ContentSchema"`
+}
+
+// loadedTheme is a theme and the filesystem it was loaded from.
+type loadedTheme struct {
+	name     string
+	fsys     fs.FS
+	manifest Theme
+}
+
+func (t loadedTheme) root(dir string) fs.FS {
+	return subFS(t.fsys, dir)
+}
+
+// loadThemes loads the themes named by a config. A name is looked up in
+// themeFSs, and is otherwise a directory relative to siteFS.
+func loadThemes(names []string, siteFS fs.FS, themeFSs map[string]fs.FS, decoders map[string]Decoder) ([]loadedTheme, error) {
+	var themes []loadedTheme
+	for _, name := range names {
+		themeFS, isRegistered := themeFSs[name]
+		if !isRegistered {
+			themeFS = subFS(siteFS, name)
+			info, err := fs.Stat(themeFS, ".")
+			if err != nil || !info.IsDir() {
+				return nil, fmt.Errorf("theme %q is neither a registered theme nor a directory of the site", name)
+			}
+		}
+
+		manifest := Theme{"content", "templates", "static", ""}
+		loader := MakeFileLoader(themeFS, ".", decoders)
+		for _, ext := range loader.Extensions() {
+			_, err := loadOptionalFile(loader, ThemeManifest+ext, &manifest)
+			if err != nil {
+				return nil, fmt.Errorf("theme %q: error loading manifest: %s", name, err.Error())
+			}
+		}
+
+		themes = append(themes, loadedTheme{name, themeFS, manifest})
+	}
+	return themes, nil
+}
+
+// themeLayers returns one root of every theme, in order of precedence.
+// Later themes take precedence over earlier ones.
+func themeLayers(themes []loadedTheme, rootFn func(Theme) string) []fs.FS {
+	layers := make([]fs.FS, 0, len(themes))
+	for i := len(themes) - 1; i >= 0; i-- {
+		layers = append(layers, themes[i].root(rootFn(themes[i].manifest)))
+	}
+	return layers
+}
+
+// layeredLoader returns a loader for a root of the site, with the same root of
+// every theme layered beneath it.
+func layeredLoader(siteFS fs.FS, root string, themeRoots []fs.FS, decoders map[string]Decoder) FileLoader {
+	if len(themeRoots) == 0 {
+		return MakeFileLoader(siteFS, root, decoders)
+	}
+	layers := append(layeredFS{subFS(siteFS, root)}, themeRoots...)
+	return MakeFileLoader(layers, ".", decoders)
+}
+
+func subFS(fsys fs.FS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, path.Clean(filepath.ToSlash(dir)))
+	if err != nil {
+		// Only invalid paths fail, and those can't be opened either.
+		return layeredFS{}
+	}
+	return sub
+}
+
+// layeredFS reads each file from the first layer which has it. Directories
+// list the files of every layer.
+type layeredFS []fs.FS
+
+func (l layeredFS) Open(name string) (fs.File, error) {
+	for _, layer := range l {
+		f, err := layer.Open(name)
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+func (l layeredFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	var entries []fs.DirEntry
+	seen := map[string]bool{}
+	isFound := false
+	for _, layer := range l {
+		layerEntries, err := fs.ReadDir(layer, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		isFound = true
+		for _, entry := range layerEntries {
+			if !seen[entry.Name()] {
+				seen[entry.Name()] = true
+				entries = append(entries, entry)
+			}
+		}
+	}
+	if !isFound {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
@@ -0,0 +1,109 @@
+package processor_test
+
+import (
+	"context"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/treaster/incant/processor"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestThemes(t *testing.T) {
+	// A theme bundled with a Go module, with its own layout and a content
+	// contract.
+	embedded := mapFS(map[string]string{
+		"theme.yaml": `
+TemplatesRoot: layouts
+ContentSchema: contract.yaml
+`,
+		"content/contract.yaml": `
+type: object
+required: [title]
+properties:
+  title: {type: string}
+`,
+		"content/mapping.yaml": `
+- SingleOutput: index.html
+  Template: index.html
+  Selector: jq:.
+- SingleOutput: about.html
+  Template: about.html
+  Selector: jq:.
+`,
+		"layouts/index.html":            `base index: {{range .}}{{.title}}{{end}}`,
+		"layouts/about.html":            `base about: {{template "_partials/footer.html"}}`,
+		"layouts/_partials/footer.html": `base footer`,
+		"static/theme.css":              `base css`,
+		"static/site.css":               `base site css`,
+	})
+
+	siteFS := mapFS(map[string]string{
+		"config.yaml": `
+ContentRoot: content
+SiteContentFile: site.yaml
+MappingFile: mapping.yaml
+TemplatesRoot: templates
+TemplatesType: go/template
+StaticRoot: static
+OutputRoot: output
+Themes: [base, themes/child]
+`,
+		"content/site.yaml": `title: My site`,
+
+		"themes/child/templates/index.html": `child index: {{range .}}{{.title}}{{end}}`,
+		"themes/child/static/theme.css":     `child css`,
+
+		"templates/_partials/footer.html": `site footer`,
+		"static/site.css":                 `site css`,
+	})
+
+	build := func(siteFS fs.FS) (*processor.BuildResult, error) {
+		return processor.Build(context.Background(), processor.BuildOptions{
+			SiteFS:     siteFS,
+			ConfigPath: "config.yaml",
+			Themes:     map[string]fs.FS{"base": embedded},
+		})
+	}
+
+	result, err := build(siteFS)
+	require.NoError(t, err)
+	require.Equal(t, map[string][]byte{
+		"index.html":       []byte("child index: My site"),
+		"about.html":       []byte("base about: site footer"),
+		"static/theme.css": []byte("child css"),
+		"static/site.css":  []byte("site css"),
+	}, result.Files)
+
+	// The site's own mapping file replaces the theme's.
+	siteFS["content/mapping.yaml"] = &fstest.MapFile{Data: []byte(`
+- SingleOutput: only.html
+  Template: index.html
+  Selector: jq:.
+`)}
+	result, err = build(siteFS)
+	require.NoError(t, err)
+	require.Contains(t, result.Files, "only.html")
+	require.NotContains(t, result.Files, "about.html")
+
+	siteFS["content/site.yaml"] = &fstest.MapFile{Data: []byte(`name: My site`)}
+	result, err = build(siteFS)
+	require.ErrorIs(t, err, processor.ErrBuildFailed)
+	require.Contains(t, result.Diagnostics[0].Message, `site content does not match the content schema of theme "base"`)
+	require.Contains(t, result.Diagnostics[0].Message, "title")
+
+	siteFS["config.yaml"] = &fstest.MapFile{Data: []byte(`
+ContentRoot: content
+SiteContentFile: site.yaml
+MappingFile: mapping.yaml
+TemplatesRoot: templates
+TemplatesType: go/template
+OutputRoot: output
+Themes: [missing]
+`)}
+	result, err = build(siteFS)
+	require.ErrorIs(t, err, processor.ErrBuildFailed)
+	require.Contains(t, result.Diagnostics[0].Message, `error loading themes: theme "missing"`)
+}
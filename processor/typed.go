@@ -0,0 +1,84 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// DecodeContent converts evaluated content, as produced by EvalContentFile
+// and selectors, into a value of type t. Decoding follows the rules of
+// encoding/json, so struct fields are matched by their json tags, or by
+// case-insensitive field name. If t is a pointer type, a pointer to a new
+// value is returned.
+func DecodeContent(content any, t reflect.Type) (any, error) {
+	contentBytes, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+
+	isPointer := t.Kind() == reflect.Pointer
+	targetType := t
+	if isPointer {
+		targetType = t.Elem()
+	}
+
+	target := reflect.New(targetType)
+	err = json.Unmarshal(contentBytes, target.Interface())
+	if err != nil {
+		return nil, err
+	}
+
+	if isPointer {
+		return target.Interface(), nil
+	}
+	return target.Elem().Interface(), nil
+}
+
+func (p *processor) RegisterType(name string, prototype any) error {
+	if prototype == nil {
+		return fmt.Errorf("cannot register nil as type %q", name)
+	}
+	_, isRegistered := p.types[name]
+	if isRegistered {
+		return fmt.Errorf("type %q is already registered", name)
+	}
+	p.types[name] = reflect.TypeOf(prototype)
+	return nil
+}
+
+// decodeMatches converts selector matches into the mapping's registered Go
+// type. Mappings without a Type are passed through unchanged.
+func (p *processor) decodeMatches(mapping MappingForTemplate, itemMatches []any) ([]any, bool) {
+	if mapping.Type == "" {
+		return itemMatches, false
+	}
+
+	t := p.types[mapping.Type]
+	hasError := false
+	typedMatches := make([]any, 0, len(itemMatches))
+	for i, item := range itemMatches {
+		typed, err := DecodeContent(item, t)
+		if err != nil {
+			hasError = p.diags.errorfln("error decoding match [%d] of selector %q into type %q (%s): %s", i, mapping.Selector, mapping.Type, t, err.Error())
+			continue
+		}
+		typedMatches = append(typedMatches, typed)
+	}
+	return typedMatches, hasError
+}
+
+// typedList wraps decoded matches in a slice of the mapping's registered type,
+// so that SingleOutput templates receive e.g. []Recipe rather than []any.
+func (p *processor) typedList(mapping MappingForTemplate, typedMatches []any) any {
+	if mapping.Type == "" {
+		return typedMatches
+	}
+
+	t := p.types[mapping.Type]
+	list := reflect.MakeSlice(reflect.SliceOf(t), 0, len(typedMatches))
+	for _, typed := range typedMatches {
+		list = reflect.Append(list, reflect.ValueOf(typed))
+	}
+	return list.Interface()
+}
@@ -0,0 +1,45 @@
+package processor_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/treaster/incant/processor"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testRecipe struct {
+	ShortName string   `json:"shortname"`
+	Title     string   `json:"title"`
+	Servings  int      `json:"servings"`
+	Tags      []string `json:"tags"`
+}
+
+func (r testRecipe) URL() string {
+	return "/recipes/" + r.ShortName + ".html"
+}
+
+func TestDecodeContent(t *testing.T) {
+	content := map[string]any{
+		"shortname": "spaghetti",
+		"title":     "Spaghetti",
+		"servings":  4,
+		"tags":      []any{"pasta", "dinner"},
+		"unused":    "ignored",
+	}
+
+	decoded, err := processor.DecodeContent(content, reflect.TypeOf(testRecipe{}))
+	require.NoError(t, err)
+	expected := testRecipe{"spaghetti", "Spaghetti", 4, []string{"pasta", "dinner"}}
+	require.Equal(t, expected, decoded)
+	require.Equal(t, "/recipes/spaghetti.html", decoded.(testRecipe).URL())
+
+	decoded, err = processor.DecodeContent(content, reflect.TypeOf(&testRecipe{}))
+	require.NoError(t, err)
+	require.Equal(t, &expected, decoded)
+
+	content["servings"] = "four"
+	_, err = processor.DecodeContent(content, reflect.TypeOf(testRecipe{}))
+	require.ErrorContains(t, err, "testRecipe.servings")
+}
@@ -1,6 +1,9 @@
 package processor
 
-import "io"
+import (
+	"io"
+	"io/fs"
+)
 
 type Config struct {
 	ContentRoot     string `yaml:"ContentRoot"`
@@ -10,6 +13,71 @@ type Config struct {
 	TemplatesRoot   string `yaml:"TemplatesRoot"`
 	TemplatesType   string `yaml:"TemplatesType"`
 	OutputRoot      string `yaml:"OutputRoot"`
+
+	// Ignore lists patterns of files to skip in each of ContentRoot,
+	// TemplatesRoot and StaticRoot, relative to that root. Patterns follow
+	// .gitignore rules, and add to any .incantignore files in the roots.
+	Ignore []string `yaml:"Ignore"`
+
+	// Themes lists themes which supply templates, static files, mappings and
+	// content. Files of the site replace theme files at the same path within
+	// the same root, and later themes replace files of earlier ones. A theme
+	// is a directory relative to the config file, unless the embedding
+	// program registered a theme of that name.
+	Themes []string `yaml:"Themes"`
+
+	// ExecAllow lists the commands which exec: content references may run,
+	// as path.Match patterns, e.g. "scripts/*.sh" or "git". Arguments aren't
+	// restricted. exec: references are disabled when it is empty.
+	// ExecCacheDir optionally keeps the output of the site's scripts between
+	// builds, but not of commands on the PATH. Both are relative to the config
+	// file.
+	ExecAllow    []string `yaml:"ExecAllow"`
+	ExecCacheDir string   `yaml:"ExecCacheDir"`
+
+	// Static lists directories of static files to copy into the output, in
+	// order. Files from later mounts replace those from earlier ones at the
+	// same output path. If empty, StaticRoot is copied to the same-named
+	// directory of the output.
+	Static []StaticMount `yaml:"Static"`
+
+	// TemplatesTypeByExtension selects the template engine for template files
+	// whose names end with a given extension, e.g. ".jet.html". Other files
+	// use TemplatesType.
+	TemplatesTypeByExtension map[string]string `yaml:"TemplatesTypeByExtension"`
+
+	// AutoEscape enables HTML escaping of values output by templates. Sites
+	// which render untrusted content should enable it.
+	AutoEscape bool `yaml:"AutoEscape"`
+
+	// HighlightStyle enables syntax highlighting of fenced code blocks in
+	// Markdown, using the named chroma style. With HighlightClasses, CSS
+	// classes are emitted instead of inline styles, and the style's
+	// stylesheet is written to HighlightStylesheet, relative to OutputRoot.
+	HighlightStyle       string `yaml:"HighlightStyle"`
+	HighlightLineNumbers bool   `yaml:"HighlightLineNumbers"`
+	HighlightClasses     bool   `yaml:"HighlightClasses"`
+	HighlightStylesheet  string `yaml:"HighlightStylesheet"`
+
+	// Languages makes the site multilingual. The site is built once per
+	// language, each with its own content overlay, output prefix and
+	// translation strings. Translations fall back to the first language.
+	Languages []Language `yaml:"Languages"`
+
+	// SiteContentSchema optionally names a JSON Schema file, relative to
+	// ContentRoot, which the evaluated site content must satisfy.
+	SiteContentSchema string `yaml:"SiteContentSchema"`
+
+	// Drafts and Future include items which would otherwise be filtered out
+	// of selector matches, for preview builds.
+	Drafts bool `yaml:"Drafts"`
+	Future bool `yaml:"Future"`
+
+	// The item fields consulted when filtering selector matches. Defaults to
+	// draft, publishDate and expiryDate.
+	DraftField       string `yaml:"DraftField"`
+	PublishDateField string `yaml:"PublishDateField"`
+	ExpiryDateField  string `yaml:"ExpiryDateField"`
 }
 
 type Content map[string]any
@@ -19,6 +87,28 @@ type RawMapping struct {
 	PerMatchOutput string `yaml:"PerMatchOutput"`
 	Template       string `yaml:"Template"`
 	Selector       string `yaml:"Selector"`
+
+	// Schema optionally names a JSON Schema file, relative to ContentRoot,
+	// which each selector match must satisfy.
+	Schema string `yaml:"Schema"`
+
+	// Type optionally names a Go type registered with
+	// Processor.RegisterType. Selector matches are decoded into that type
+	// before being passed to the template.
+	Type string `yaml:"Type"`
+
+	// TemplatesType optionally overrides the engine used for Template. Every
+	// mapping using the same template must agree on its engine.
+	TemplatesType string `yaml:"TemplatesType"`
+
+	// Redirect mappings. Aliases is evaluated against each match to produce
+	// the old paths, and RedirectTo produces the single path they point at.
+	// Aliases may produce a list of paths, and matches where it produces
+	// null have no aliases, so jq:.aliases suits items without the field.
+	Aliases       string `yaml:"Aliases"`
+	RedirectTo    string `yaml:"RedirectTo"`
+	RedirectsFile string `yaml:"RedirectsFile"`
+	NginxMapFile  string `yaml:"NginxMapFile"`
 }
 
 type MappingForTemplate struct {
@@ -26,15 +116,43 @@ type MappingForTemplate struct {
 	PerMatchOutput string
 	Template       string
 	Selector       string
+	Schema         *Schema
+	Type           string
+
+	Aliases       string
+	RedirectTo    string
+	RedirectsFile string
+	NginxMapFile  string
 }
 
 type Processor interface {
-	LoadTemplates() bool
+	// RegisterType makes a Go type available to mappings under the given
+	// name. The type is taken from prototype, e.g. Recipe{} or &Recipe{}.
+	RegisterType(name string, prototype any) error
+
+	// LoadMappings must be called before LoadTemplates, since mappings may
+	// choose the engine their templates are parsed with.
 	LoadSiteContent() (any, bool)
 	LoadMappings() ([]MappingForTemplate, bool)
+	LoadTemplates() bool
 	ClearExistingOutput() bool
 	ProcessContent([]MappingForTemplate, any) bool
+	Lint([]MappingForTemplate, any) bool
 	CopyStatic() bool
+	// CloseOutput must be called last. Archive outputs are only written
+	// when it is called.
+	CloseOutput() bool
+}
+
+type TemplateMgrOptions struct {
+	// DataFS holds the files read by DataUrl. If nil, DataUrl reads from the
+	// working directory.
+	DataFS fs.FS
+	// AutoEscape enables HTML escaping of template output.
+	AutoEscape bool
+	// Funcs are the functions available to templates, keyed by name. If nil,
+	// StdTemplateFuncs(DataFS) is used.
+	Funcs map[string]any
 }
 
 type TemplateMgr interface {
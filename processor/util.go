@@ -2,49 +2,39 @@ package processor
 
 import (
 	"fmt"
-	"io"
 	"io/fs"
-	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/itchyny/gojq"
 )
 
-func FindFiles(fileRoot string) []string {
+// FindFiles returns every file beneath fileRoot, except dotfiles and files
+// ignored by ignore or an IgnoreFile. It fails if an IgnoreFile is malformed.
+func FindFiles(fsys fs.FS, fileRoot string, ignore *IgnoreMatcher) ([]string, error) {
 	var files []string
-	filepath.WalkDir(fileRoot, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			fmt.Println(err.Error())
-		}
+	err := walkFiles(fsys, fileRoot, ignore, func(path string) {
 		baseName := filepath.Base(path)
 		if baseName[0] == '.' {
 			fmt.Printf("skipping dotfile %s\n", path)
-			return nil
-		}
-		if !d.IsDir() {
-			files = append(files, path)
+			return
 		}
-		return nil
+		files = append(files, path)
 	})
 
-	return files
+	return files, err
 }
 
-func FindFilesWithName(fileRoot string, targetName string) []string {
+func FindFilesWithName(fsys fs.FS, fileRoot string, targetName string, ignore *IgnoreMatcher) ([]string, error) {
 	var files []string
-	filepath.WalkDir(fileRoot, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			fmt.Println(err.Error())
-		}
+	err := walkFiles(fsys, fileRoot, ignore, func(path string) {
 		baseName := filepath.Base(path)
 		if baseName == targetName {
 			files = append(files, path)
 		}
-		return nil
 	})
 
-	return files
+	return files, err
 }
 
 func Printfln(format string, args ...any) {
@@ -56,36 +46,6 @@ func Errorfln(format string, args ...any) bool {
 	return true
 }
 
-// From https://stackoverflow.com/questions/21060945/simple-way-to-copy-a-file/74107689#74107689
-//
-// Copy copies the contents of the file at srcpath to a regular file
-// at dstpath. If the file named by dstpath already exists, it is
-// truncated. The function does not copy the file mode, file
-// permission bits, or file attributes.
-func Copy(srcpath, dstpath string) (err error) {
-	r, err := os.Open(srcpath)
-	if err != nil {
-		return err
-	}
-	defer r.Close() // ignore error: file was opened read-only.
-
-	w, err := os.Create(dstpath)
-	if err != nil {
-		return err
-	}
-
-	defer func() {
-		// Report the error, if any, from Close, but do so
-		// only if there isn't already an outgoing error.
-		if c := w.Close(); err == nil {
-			err = c
-		}
-	}()
-
-	_, err = io.Copy(w, r)
-	return err
-}
-
 func TrimExt(path string) (string, string) {
 	ext := filepath.Ext(path)
 	noExt, hasExt := strings.CutSuffix(path, ext)